@@ -0,0 +1,88 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ArgoTenantPolicySpec defines the AppProject settings for the selected Tenants.
+//
+// All policies selecting a Tenant are merged into its AppProject. Policies are ordered
+// by descending priority and then by name. List fields are joined in that order, while
+// the orphanedResources settings are taken from the first policy which defines them.
+// As the lists are joined, a policy of higher priority can not narrow the repositories or
+// resources a policy of lower priority allows; the priority only decides orphanedResources.
+// Policies marked as default are only considered when no other policy selects the Tenant.
+// If neither applies, every source repository and resource is allowed.
+type ArgoTenantPolicySpec struct {
+	// Selects the Tenants this policy is applied to. An empty selector matches all Tenants,
+	// while an omitted selector matches none.
+	TenantSelector *metav1.LabelSelector `json:"tenantSelector,omitempty"`
+	// Applies this policy to all Tenants which are not selected by any non-default policy.
+	// +kubebuilder:default=false
+	Default bool `json:"default,omitempty"`
+	// Policies with a higher priority take precedence over policies with a lower priority.
+	// +kubebuilder:default=0
+	Priority int32 `json:"priority,omitempty"`
+	// Repositories the Tenant may deploy from.
+	SourceRepos []string `json:"sourceRepos,omitempty"`
+	// Cluster-scoped resources the Tenant may deploy.
+	ClusterResourceWhitelist []metav1.GroupKind `json:"clusterResourceWhitelist,omitempty"`
+	// Cluster-scoped resources the Tenant must not deploy.
+	ClusterResourceBlacklist []metav1.GroupKind `json:"clusterResourceBlacklist,omitempty"`
+	// Namespaced resources the Tenant may deploy.
+	NamespaceResourceWhitelist []metav1.GroupKind `json:"namespaceResourceWhitelist,omitempty"`
+	// Namespaced resources the Tenant must not deploy.
+	NamespaceResourceBlacklist []metav1.GroupKind `json:"namespaceResourceBlacklist,omitempty"`
+	// Orphaned resources monitoring of the AppProject.
+	OrphanedResources *OrphanedResourcesMonitorSettings `json:"orphanedResources,omitempty"`
+	// GnuPG keys commits must be signed with to be synced.
+	SignatureKeys []SignatureKey `json:"signatureKeys,omitempty"`
+}
+
+// OrphanedResourcesMonitorSettings mirrors the orphanedResources field of an AppProject.
+type OrphanedResourcesMonitorSettings struct {
+	// Emit a warning condition on Applications with orphaned resources.
+	Warn *bool `json:"warn,omitempty"`
+	// Resources which are not considered orphaned.
+	Ignore []OrphanedResourceKey `json:"ignore,omitempty"`
+}
+
+// OrphanedResourceKey identifies resources excluded from orphaned resources monitoring.
+type OrphanedResourceKey struct {
+	Group string `json:"group,omitempty"`
+	Kind  string `json:"kind,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// SignatureKey references a GnuPG public key known to Argo CD.
+type SignatureKey struct {
+	// ID of the key in hexadecimal notation.
+	KeyID string `json:"keyID"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Priority",type="integer",JSONPath=".spec.priority",description="Policy priority"
+// +kubebuilder:printcolumn:name="Default",type="boolean",JSONPath=".spec.default",description="Default policy"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="Age"
+
+// ArgoTenantPolicy is the Schema for the Argo tenant policy API.
+type ArgoTenantPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ArgoTenantPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ArgoTenantPolicyList contains a list of ArgoTenantPolicy.
+type ArgoTenantPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ArgoTenantPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ArgoTenantPolicy{}, &ArgoTenantPolicyList{})
+}
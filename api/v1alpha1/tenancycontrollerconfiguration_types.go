@@ -0,0 +1,223 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Deletion policies of the artifacts of deleted Tenants
+const (
+	// Deletes all artifacts
+	DeletionPolicyDelete = "Delete"
+	// Keeps all artifacts
+	DeletionPolicyRetain = "Retain"
+	// Keeps all artifacts until the archive retention passed
+	DeletionPolicyArchive = "Archive"
+)
+
+// Handling of the Argo CD Applications of Tenants which are deleted
+const (
+	// Tenants are not deleted while Applications or ApplicationSets of their project exist
+	ApplicationDeletionPolicyBlock = "Block"
+	// Applications and ApplicationSets are deleted and pruned before the Tenant
+	ApplicationDeletionPolicyCascade = "Cascade"
+)
+
+// TenancyControllerConfigurationSpec defines the runtime configuration of the tenancy controller.
+// Omitted fields fall back to the values given as command line flags.
+type TenancyControllerConfigurationSpec struct {
+	// Capsule proxy the Argo CD clusters of the tenants are pointed at.
+	CapsuleProxy CapsuleProxySpec `json:"capsuleProxy,omitempty"`
+	// Namespace of the Argo CD installation.
+	ArgoCDNamespace string `json:"argoCDNamespace,omitempty"`
+	// Argo CD instances the tenants are provisioned in. When omitted, tenants are provisioned
+	// in the instance installed in argoCDNamespace.
+	ArgoCDInstances []ArgoCDInstanceSpec `json:"argoCDInstances,omitempty"`
+	// Namespace where the ServiceAccounts of user tenants are created.
+	UserTenantNamespace string `json:"userTenantNamespace,omitempty"`
+	// Namespace where the ServiceAccounts of system tenants are created.
+	SystemTenantNamespace string `json:"systemTenantNamespace,omitempty"`
+	// Roles created in the AppProject of each tenant. When omitted, the built-in
+	// owners, maintainers, operators and viewers roles are used.
+	Roles []ArgoProjectRoleSpec `json:"roles,omitempty"`
+	// Annotation keys Tenants may set to override their Argo CD settings, such as argocd.capsule/source-repos.
+	// Override annotations which are not listed are ignored and reported with an Event.
+	AllowedOverrides []string `json:"allowedOverrides,omitempty"`
+	// Lifetime of the ServiceAccount tokens requested for Argo CD. Tokens are rotated
+	// when less than a third of their lifetime remains. Must be at least 10m.
+	// +kubebuilder:validation:XValidation:rule="duration(self) >= duration('10m')",message="must be at least 10m"
+	TokenTTL *metav1.Duration `json:"tokenTTL,omitempty"`
+	// What happens to the artifacts of deleted Tenants. Retained and archived artifacts are no longer
+	// owned by the Tenant. Tenants may override the policy with the argocd.capsule/deletion-policy annotation.
+	// +kubebuilder:validation:Enum=Delete;Retain;Archive
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+	// How long archived artifacts are kept before they are removed.
+	ArchiveRetention *metav1.Duration `json:"archiveRetention,omitempty"`
+	// What happens to the Applications and ApplicationSets of Tenants which are deleted with the Delete policy.
+	// +kubebuilder:validation:Enum=Block;Cascade
+	ApplicationDeletionPolicy string `json:"applicationDeletionPolicy,omitempty"`
+	// Create a <tenant>-apps namespace for every Tenant of this cluster, which belongs to the Tenant
+	// and is watched by Argo CD, so the Tenant can create its own Applications.
+	AppsNamespace *bool `json:"appsNamespace,omitempty"`
+	// Project role created for Tenants which request a CI token with the argocd.capsule/ci-token-namespace
+	// annotation. When omitted, the built-in ci role may get, create, update and sync applications.
+	CIRole *ArgoProjectRoleSpec `json:"ciRole,omitempty"`
+	// Lifetime of the CI tokens. Tokens are re-issued when less than a third of their lifetime remains.
+	// Must be at least 10m.
+	// +kubebuilder:validation:XValidation:rule="duration(self) >= duration('10m')",message="must be at least 10m"
+	CITokenTTL *metav1.Duration `json:"ciTokenTTL,omitempty"`
+	// Go template of the AppProject of each Tenant, replacing the template passed with --project-template.
+	ProjectTemplate string `json:"projectTemplate,omitempty"`
+	// Member clusters whose Tenants are registered in the Argo CD of this cluster.
+	// Member clusters are only read when the controller starts.
+	MemberClusters []MemberClusterSpec `json:"memberClusters,omitempty"`
+}
+
+// ArgoCDInstanceSpec defines an Argo CD instance and the tenants routed to it.
+type ArgoCDInstanceSpec struct {
+	// Name of the instance.
+	Name string `json:"name"`
+	// Namespace of the Argo CD installation.
+	Namespace string `json:"namespace"`
+	// Name of the RBAC ConfigMap of the instance.
+	// +kubebuilder:default=argocd-rbac-cm
+	RBACConfigMap string `json:"rbacConfigMap,omitempty"`
+	// Name of the ConfigMap holding the command parameters of the instance. Its application.namespaces
+	// key is maintained from the sourceNamespaces of the tenants' AppProjects.
+	// +kubebuilder:default=argocd-cmd-params-cm
+	CmdParamsConfigMap string `json:"cmdParamsConfigMap,omitempty"`
+	// API of the instance, used to issue the tokens of the CI project roles. Tenants can not request
+	// CI tokens from instances without API.
+	API *ArgoCDAPISpec `json:"api,omitempty"`
+	// Tenants matching the selector are provisioned in the instance. Every tenant is provisioned when omitted.
+	TenantSelector *metav1.LabelSelector `json:"tenantSelector,omitempty"`
+}
+
+// ArgoCDAPISpec defines how the API of an Argo CD instance is reached.
+type ArgoCDAPISpec struct {
+	// URL of the Argo CD server, such as https://argocd-server.argocd.svc.
+	URL string `json:"url"`
+	// Secret in the namespace of the instance holding the token of an account which may update projects.
+	TokenSecret string `json:"tokenSecret"`
+	// Key of the token in the Secret.
+	// +kubebuilder:default=token
+	TokenKey string `json:"tokenKey,omitempty"`
+	// Skip the verification of the server certificate.
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// MemberClusterSpec defines a member cluster and the capsule-proxy Argo CD reaches it through.
+type MemberClusterSpec struct {
+	// Name of the member cluster, appended to the names of the Argo CD clusters of its tenants.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+	// Secret holding the kubeconfig of the member cluster.
+	Kubeconfig KubeconfigSecretSpec `json:"kubeconfig"`
+	// URL of the member cluster's capsule-proxy, reachable from Argo CD.
+	ProxyEndpoint string `json:"proxyEndpoint"`
+	// Server name Argo CD verifies the member cluster's capsule-proxy certificate against.
+	ProxyServerName string `json:"proxyServerName,omitempty"`
+	// Key of the kubeconfig Secret holding the PEM encoded CA certificate of the member cluster's
+	// capsule-proxy. Argo CD skips the certificate verification when omitted.
+	ProxyCAKey string `json:"proxyCAKey,omitempty"`
+}
+
+// KubeconfigSecretSpec references a kubeconfig stored in a Secret.
+type KubeconfigSecretSpec struct {
+	// Name of the Secret.
+	Name string `json:"name"`
+	// Namespace of the Secret.
+	Namespace string `json:"namespace"`
+	// Key of the kubeconfig.
+	// +kubebuilder:default=kubeconfig
+	Key string `json:"key,omitempty"`
+}
+
+// ArgoProjectRoleSpec maps Capsule role bindings to an Argo CD project role.
+type ArgoProjectRoleSpec struct {
+	// Name of the role in the AppProject.
+	Name string `json:"name"`
+	// Description of the role in the AppProject.
+	Description string `json:"description,omitempty"`
+	// Subjects of the tenant's additionalRoleBindings referencing one of these ClusterRoles are assigned to the role.
+	ClusterRoles []string `json:"clusterRoles,omitempty"`
+	// Tenant owners holding one of these ClusterRoles are assigned to the role. Owners which do not list any
+	// hold Capsule's default admin and capsule-namespace-deleter. "*" matches every owner.
+	OwnerClusterRoles []string `json:"ownerClusterRoles,omitempty"`
+	// Role of the tenant in the Argo CD policy csv the subjects of this role are assigned to. Owners list the
+	// tenant's clusters and read its project, maintainers read the repositories and the tenant's clusters. Defaults
+	// to owner for roles of owners with admin, maintainer for roles of tenant:maintainer and none otherwise.
+	// +kubebuilder:validation:Enum=owner;maintainer;none
+	TenantRole string `json:"tenantRole,omitempty"`
+	// Permissions of the role on the tenant's project.
+	Permissions []ArgoPermission `json:"permissions,omitempty"`
+}
+
+// ArgoPermission grants or denies an action on a resource of the tenant's project.
+type ArgoPermission struct {
+	// Argo CD resource, such as applications, applicationsets, logs, exec or repositories.
+	Resource string `json:"resource"`
+	// Action on the resource, such as get, create, update, sync, override or "*".
+	Action string `json:"action"`
+	// +kubebuilder:default=allow
+	// +kubebuilder:validation:Enum=allow;deny
+	Effect string `json:"effect,omitempty"`
+}
+
+// CapsuleProxySpec defines how the capsule-proxy is reached.
+type CapsuleProxySpec struct {
+	// Name of the capsule-proxy Service.
+	ServiceName string `json:"serviceName,omitempty"`
+	// Namespace of the capsule-proxy Service.
+	ServiceNamespace string `json:"serviceNamespace,omitempty"`
+	// Port capsule-proxy is listening on.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	ServicePort int32 `json:"servicePort,omitempty"`
+	// Server name Argo CD verifies the capsule-proxy certificate against.
+	// Defaults to the hostname of the capsule-proxy Service.
+	ServerName string `json:"serverName,omitempty"`
+	// CA certificate of capsule-proxy. Argo CD skips the certificate verification when omitted.
+	CA *CapsuleProxyCASpec `json:"ca,omitempty"`
+}
+
+// CapsuleProxyCASpec references the CA certificate of capsule-proxy.
+type CapsuleProxyCASpec struct {
+	// Kind of the object holding the CA certificate.
+	// +kubebuilder:default=Secret
+	// +kubebuilder:validation:Enum=Secret;ConfigMap
+	Kind string `json:"kind,omitempty"`
+	// Name of the object holding the CA certificate.
+	Name string `json:"name"`
+	// Namespace of the object holding the CA certificate. Defaults to the capsule-proxy namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// Key of the PEM encoded CA certificate.
+	// +kubebuilder:default=ca.crt
+	Key string `json:"key,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Argo CD Namespace",type="string",JSONPath=".spec.argoCDNamespace",description="Argo CD namespace"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="Age"
+
+// TenancyControllerConfiguration is the Schema for the tenancy controller configuration API.
+// Only the instance with the name given to the controller is considered.
+type TenancyControllerConfiguration struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TenancyControllerConfigurationSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TenancyControllerConfigurationList contains a list of TenancyControllerConfiguration.
+type TenancyControllerConfigurationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TenancyControllerConfiguration `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TenancyControllerConfiguration{}, &TenancyControllerConfigurationList{})
+}
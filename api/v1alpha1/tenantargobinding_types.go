@@ -0,0 +1,76 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// The Argo CD integration of the Tenant is provisioned
+	ConditionReady = "Ready"
+	// The last provisioning of the Argo CD integration failed
+	ConditionDegraded = "Degraded"
+	// Argo CD Applications of the Tenant delay its deletion
+	ConditionDeletionBlocked = "DeletionBlocked"
+)
+
+// TenantArgoBindingStatus reports the state of the Argo CD integration of a Tenant.
+type TenantArgoBindingStatus struct {
+	// Member cluster the Tenant is located in, empty for Tenants of the local cluster.
+	Cluster string `json:"cluster,omitempty"`
+	// Server URL of the Argo CD cluster registered for the Tenant.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Name of the Tenant's AppProject.
+	AppProject string `json:"appProject,omitempty"`
+	// Argo CD instances the Tenant is provisioned in.
+	Instances []string `json:"instances,omitempty"`
+	// Groups assigned to the roles of the AppProject.
+	Roles []ArgoRoleAssignment `json:"roles,omitempty"`
+	// Expiration of the token Argo CD uses to access the cluster. Omitted for tokens without expiration.
+	TokenExpirationTimestamp *metav1.Time `json:"tokenExpirationTimestamp,omitempty"`
+	// Expiration of the earliest expiring CI token issued for the Tenant.
+	CITokenExpirationTimestamp *metav1.Time `json:"ciTokenExpirationTimestamp,omitempty"`
+	// Time of the last successful reconciliation.
+	LastSuccessfulReconcileTime *metav1.Time `json:"lastSuccessfulReconcileTime,omitempty"`
+	// Generation of the Tenant observed by the last reconciliation.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Ready, Degraded and DeletionBlocked conditions.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ArgoRoleAssignment lists the groups assigned to an AppProject role.
+type ArgoRoleAssignment struct {
+	// Name of the role.
+	Name string `json:"name"`
+	// Users and groups assigned to the role.
+	Groups []string `json:"groups,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Ready"
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".status.cluster",description="Member cluster"
+// +kubebuilder:printcolumn:name="Endpoint",type="string",JSONPath=".status.endpoint",description="Argo CD cluster endpoint"
+// +kubebuilder:printcolumn:name="AppProject",type="string",JSONPath=".status.appProject",description="Argo CD AppProject"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="Age"
+
+// TenantArgoBinding reports the provisioning status of the Argo CD integration of the Tenant with the same name.
+type TenantArgoBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status TenantArgoBindingStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TenantArgoBindingList contains a list of TenantArgoBinding.
+type TenantArgoBindingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TenantArgoBinding `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TenantArgoBinding{}, &TenantArgoBindingList{})
+}
@@ -0,0 +1,576 @@
+//go:build !ignore_autogenerated
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArgoCDAPISpec) DeepCopyInto(out *ArgoCDAPISpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArgoCDAPISpec.
+func (in *ArgoCDAPISpec) DeepCopy() *ArgoCDAPISpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ArgoCDAPISpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArgoCDInstanceSpec) DeepCopyInto(out *ArgoCDInstanceSpec) {
+	*out = *in
+	if in.API != nil {
+		in, out := &in.API, &out.API
+		*out = new(ArgoCDAPISpec)
+		**out = **in
+	}
+	if in.TenantSelector != nil {
+		in, out := &in.TenantSelector, &out.TenantSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArgoCDInstanceSpec.
+func (in *ArgoCDInstanceSpec) DeepCopy() *ArgoCDInstanceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ArgoCDInstanceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArgoPermission) DeepCopyInto(out *ArgoPermission) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArgoPermission.
+func (in *ArgoPermission) DeepCopy() *ArgoPermission {
+	if in == nil {
+		return nil
+	}
+	out := new(ArgoPermission)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArgoProjectRoleSpec) DeepCopyInto(out *ArgoProjectRoleSpec) {
+	*out = *in
+	if in.ClusterRoles != nil {
+		in, out := &in.ClusterRoles, &out.ClusterRoles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.OwnerClusterRoles != nil {
+		in, out := &in.OwnerClusterRoles, &out.OwnerClusterRoles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Permissions != nil {
+		in, out := &in.Permissions, &out.Permissions
+		*out = make([]ArgoPermission, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArgoProjectRoleSpec.
+func (in *ArgoProjectRoleSpec) DeepCopy() *ArgoProjectRoleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ArgoProjectRoleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArgoRoleAssignment) DeepCopyInto(out *ArgoRoleAssignment) {
+	*out = *in
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArgoRoleAssignment.
+func (in *ArgoRoleAssignment) DeepCopy() *ArgoRoleAssignment {
+	if in == nil {
+		return nil
+	}
+	out := new(ArgoRoleAssignment)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArgoTenantPolicy) DeepCopyInto(out *ArgoTenantPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArgoTenantPolicy.
+func (in *ArgoTenantPolicy) DeepCopy() *ArgoTenantPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ArgoTenantPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ArgoTenantPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArgoTenantPolicyList) DeepCopyInto(out *ArgoTenantPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ArgoTenantPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArgoTenantPolicyList.
+func (in *ArgoTenantPolicyList) DeepCopy() *ArgoTenantPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(ArgoTenantPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ArgoTenantPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArgoTenantPolicySpec) DeepCopyInto(out *ArgoTenantPolicySpec) {
+	*out = *in
+	if in.TenantSelector != nil {
+		in, out := &in.TenantSelector, &out.TenantSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SourceRepos != nil {
+		in, out := &in.SourceRepos, &out.SourceRepos
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ClusterResourceWhitelist != nil {
+		in, out := &in.ClusterResourceWhitelist, &out.ClusterResourceWhitelist
+		*out = make([]v1.GroupKind, len(*in))
+		copy(*out, *in)
+	}
+	if in.ClusterResourceBlacklist != nil {
+		in, out := &in.ClusterResourceBlacklist, &out.ClusterResourceBlacklist
+		*out = make([]v1.GroupKind, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceResourceWhitelist != nil {
+		in, out := &in.NamespaceResourceWhitelist, &out.NamespaceResourceWhitelist
+		*out = make([]v1.GroupKind, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceResourceBlacklist != nil {
+		in, out := &in.NamespaceResourceBlacklist, &out.NamespaceResourceBlacklist
+		*out = make([]v1.GroupKind, len(*in))
+		copy(*out, *in)
+	}
+	if in.OrphanedResources != nil {
+		in, out := &in.OrphanedResources, &out.OrphanedResources
+		*out = new(OrphanedResourcesMonitorSettings)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SignatureKeys != nil {
+		in, out := &in.SignatureKeys, &out.SignatureKeys
+		*out = make([]SignatureKey, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArgoTenantPolicySpec.
+func (in *ArgoTenantPolicySpec) DeepCopy() *ArgoTenantPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ArgoTenantPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapsuleProxyCASpec) DeepCopyInto(out *CapsuleProxyCASpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapsuleProxyCASpec.
+func (in *CapsuleProxyCASpec) DeepCopy() *CapsuleProxyCASpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CapsuleProxyCASpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CapsuleProxySpec) DeepCopyInto(out *CapsuleProxySpec) {
+	*out = *in
+	if in.CA != nil {
+		in, out := &in.CA, &out.CA
+		*out = new(CapsuleProxyCASpec)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CapsuleProxySpec.
+func (in *CapsuleProxySpec) DeepCopy() *CapsuleProxySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CapsuleProxySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubeconfigSecretSpec) DeepCopyInto(out *KubeconfigSecretSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeconfigSecretSpec.
+func (in *KubeconfigSecretSpec) DeepCopy() *KubeconfigSecretSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KubeconfigSecretSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MemberClusterSpec) DeepCopyInto(out *MemberClusterSpec) {
+	*out = *in
+	out.Kubeconfig = in.Kubeconfig
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MemberClusterSpec.
+func (in *MemberClusterSpec) DeepCopy() *MemberClusterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MemberClusterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OrphanedResourceKey) DeepCopyInto(out *OrphanedResourceKey) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OrphanedResourceKey.
+func (in *OrphanedResourceKey) DeepCopy() *OrphanedResourceKey {
+	if in == nil {
+		return nil
+	}
+	out := new(OrphanedResourceKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OrphanedResourcesMonitorSettings) DeepCopyInto(out *OrphanedResourcesMonitorSettings) {
+	*out = *in
+	if in.Warn != nil {
+		in, out := &in.Warn, &out.Warn
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Ignore != nil {
+		in, out := &in.Ignore, &out.Ignore
+		*out = make([]OrphanedResourceKey, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OrphanedResourcesMonitorSettings.
+func (in *OrphanedResourcesMonitorSettings) DeepCopy() *OrphanedResourcesMonitorSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(OrphanedResourcesMonitorSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SignatureKey) DeepCopyInto(out *SignatureKey) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SignatureKey.
+func (in *SignatureKey) DeepCopy() *SignatureKey {
+	if in == nil {
+		return nil
+	}
+	out := new(SignatureKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenancyControllerConfiguration) DeepCopyInto(out *TenancyControllerConfiguration) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TenancyControllerConfiguration.
+func (in *TenancyControllerConfiguration) DeepCopy() *TenancyControllerConfiguration {
+	if in == nil {
+		return nil
+	}
+	out := new(TenancyControllerConfiguration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TenancyControllerConfiguration) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenancyControllerConfigurationList) DeepCopyInto(out *TenancyControllerConfigurationList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]TenancyControllerConfiguration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TenancyControllerConfigurationList.
+func (in *TenancyControllerConfigurationList) DeepCopy() *TenancyControllerConfigurationList {
+	if in == nil {
+		return nil
+	}
+	out := new(TenancyControllerConfigurationList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TenancyControllerConfigurationList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenancyControllerConfigurationSpec) DeepCopyInto(out *TenancyControllerConfigurationSpec) {
+	*out = *in
+	in.CapsuleProxy.DeepCopyInto(&out.CapsuleProxy)
+	if in.ArgoCDInstances != nil {
+		in, out := &in.ArgoCDInstances, &out.ArgoCDInstances
+		*out = make([]ArgoCDInstanceSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Roles != nil {
+		in, out := &in.Roles, &out.Roles
+		*out = make([]ArgoProjectRoleSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AllowedOverrides != nil {
+		in, out := &in.AllowedOverrides, &out.AllowedOverrides
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TokenTTL != nil {
+		in, out := &in.TokenTTL, &out.TokenTTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.ArchiveRetention != nil {
+		in, out := &in.ArchiveRetention, &out.ArchiveRetention
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.AppsNamespace != nil {
+		in, out := &in.AppsNamespace, &out.AppsNamespace
+		*out = new(bool)
+		**out = **in
+	}
+	if in.CIRole != nil {
+		in, out := &in.CIRole, &out.CIRole
+		*out = new(ArgoProjectRoleSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CITokenTTL != nil {
+		in, out := &in.CITokenTTL, &out.CITokenTTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MemberClusters != nil {
+		in, out := &in.MemberClusters, &out.MemberClusters
+		*out = make([]MemberClusterSpec, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TenancyControllerConfigurationSpec.
+func (in *TenancyControllerConfigurationSpec) DeepCopy() *TenancyControllerConfigurationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TenancyControllerConfigurationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenantArgoBinding) DeepCopyInto(out *TenantArgoBinding) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TenantArgoBinding.
+func (in *TenantArgoBinding) DeepCopy() *TenantArgoBinding {
+	if in == nil {
+		return nil
+	}
+	out := new(TenantArgoBinding)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TenantArgoBinding) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenantArgoBindingList) DeepCopyInto(out *TenantArgoBindingList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]TenantArgoBinding, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TenantArgoBindingList.
+func (in *TenantArgoBindingList) DeepCopy() *TenantArgoBindingList {
+	if in == nil {
+		return nil
+	}
+	out := new(TenantArgoBindingList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TenantArgoBindingList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenantArgoBindingStatus) DeepCopyInto(out *TenantArgoBindingStatus) {
+	*out = *in
+	if in.Instances != nil {
+		in, out := &in.Instances, &out.Instances
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Roles != nil {
+		in, out := &in.Roles, &out.Roles
+		*out = make([]ArgoRoleAssignment, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TokenExpirationTimestamp != nil {
+		in, out := &in.TokenExpirationTimestamp, &out.TokenExpirationTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.CITokenExpirationTimestamp != nil {
+		in, out := &in.CITokenExpirationTimestamp, &out.CITokenExpirationTimestamp
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSuccessfulReconcileTime != nil {
+		in, out := &in.LastSuccessfulReconcileTime, &out.LastSuccessfulReconcileTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TenantArgoBindingStatus.
+func (in *TenantArgoBindingStatus) DeepCopy() *TenantArgoBindingStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TenantArgoBindingStatus)
+	in.DeepCopyInto(out)
+	return out
+}
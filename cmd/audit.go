@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/pkg/controller"
+	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Compares the desired state of all Tenants with the live objects, exits with 1 on drift and 2 on errors
+func auditCommand(options *rootCmdFlags) *cobra.Command {
+	output := "table"
+
+	command := &cobra.Command{
+		Use:          "audit",
+		SilenceUsage: true,
+		Short:        "Report missing, drifted and orphaned artifacts of the Tenants in the cluster",
+		Long: "Computes the desired state of every Tenant and compares it with the live AppProjects, cluster secrets, " +
+			"proxy Services and policy csv keys, without changing anything. Exits with 1 when there is drift and with 2 on errors.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			items, err := audit(cmd, options, output)
+			if err != nil {
+				fmt.Fprintln(cmd.ErrOrStderr(), "Error:", err)
+				os.Exit(controller.AuditExitError)
+			}
+
+			if code := controller.AuditExitCode(items); code != 0 {
+				os.Exit(code)
+			}
+
+			return nil
+		},
+	}
+
+	command.Flags().StringVarP(&output, "output", "o", output, "output format (table or json)")
+
+	return command
+}
+
+// Runs the audit and prints the items in the output format
+func audit(cmd *cobra.Command, options *rootCmdFlags, output string) ([]controller.AuditItem, error) {
+	if output != "table" && output != "json" {
+		return nil, fmt.Errorf("output must be table or json, got %q", output)
+	}
+
+	controllerOptions, err := options.controllerOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := controller.Audit(cmd.Context(), c, controllerOptions, options.configurationName, options.logger.WithName("audit"))
+	if err != nil {
+		return nil, err
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(items); err != nil {
+			return nil, err
+		}
+	} else {
+		writer := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "STATUS\tTENANT\tKIND\tNAMESPACE\tNAME\tDETAILS")
+		for _, item := range items {
+			details := strings.Join(item.Fields, ",")
+			if item.Message != "" {
+				details = item.Message
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", item.Status, item.Tenant, item.Kind, item.Namespace, item.Name, details)
+		}
+		if err := writer.Flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	return items, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/pkg/controller"
+	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Evaluates a request against the live Argo CD RBAC policies, exits with 1 when it is denied
+func explainCommand(options *rootCmdFlags) *cobra.Command {
+	instance := ""
+	groups := []string{}
+
+	command := &cobra.Command{
+		Use:          "explain <subject> <resource> <action> <object>",
+		Args:         cobra.ExactArgs(4),
+		SilenceUsage: true,
+		Short:        "Explain whether a user or group may perform an action in Argo CD",
+		Long: "Loads the live RBAC ConfigMap and the project roles of the AppProjects of an Argo CD instance and evaluates " +
+			"the request with Argo CD's RBAC model, printing the roles of each subject and the policy lines which matched. " +
+			"Exits with 1 when the request is denied.",
+		Example: "  tenancy-controller explain solar-admins applications sync solar/my-app\n" +
+			"  tenancy-controller explain alice@example.com applications get solar/my-app --group solar-admins",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			controllerOptions, err := options.controllerOptions()
+			if err != nil {
+				return err
+			}
+
+			c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+			if err != nil {
+				return err
+			}
+
+			enforcer, err := controller.ArgoEnforcer(cmd.Context(), c, controllerOptions, options.configurationName, instance, options.logger.WithName("explain"))
+			if err != nil {
+				return err
+			}
+
+			explanations, err := enforcer.Explain(append([]string{args[0]}, groups...), args[1], args[2], args[3])
+			if err != nil {
+				return err
+			}
+
+			allowed := false
+			out := cmd.OutOrStdout()
+			for _, explanation := range explanations {
+				allowed = allowed || explanation.Allowed
+
+				decision := "denied"
+				if explanation.Allowed {
+					decision = "allowed"
+				}
+				fmt.Fprintf(out, "%s: %s\n", explanation.Subject, decision)
+				if len(explanation.Roles) > 0 {
+					fmt.Fprintf(out, "  roles: %s\n", strings.Join(explanation.Roles, ", "))
+				}
+				for _, matched := range explanation.Matched {
+					line, err := matched.Line()
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(out, "  %s  (%s)\n", line, matched.Source)
+				}
+				if len(explanation.Matched) == 0 {
+					fmt.Fprintln(out, "  no policy matched")
+				}
+			}
+
+			if allowed {
+				fmt.Fprintf(out, "%s %s on %s %s is allowed\n", args[0], args[2], args[1], args[3])
+				return nil
+			}
+
+			fmt.Fprintf(out, "%s %s on %s %s is denied\n", args[0], args[2], args[1], args[3])
+			os.Exit(1)
+
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&instance, "instance", instance, "name of the Argo CD instance (required with several instances)")
+	command.Flags().StringSliceVar(&groups, "group", groups, "groups of the subject, evaluated like the groups claim")
+
+	return command
+}
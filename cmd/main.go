@@ -1,10 +1,16 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/project"
 	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/pkg/controller"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/pkg/webhook"
 	"github.com/go-logr/logr"
 	"github.com/go-logr/stdr"
 	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
@@ -19,6 +25,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	crlog "sigs.k8s.io/controller-runtime/pkg/log"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	crwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 type rootCmdFlags struct {
@@ -32,6 +39,34 @@ type rootCmdFlags struct {
 	enableLeaderElection         bool
 	metricsAddr                  string
 	argoCDNamespace              string
+	configurationName            string
+	projectTemplatePath          string
+	tokenTTL                     time.Duration
+	capsuleProxyServerName       string
+	capsuleProxyCAKind           string
+	capsuleProxyCAName           string
+	capsuleProxyCAKey            string
+	orphanSweepInterval          time.Duration
+	deletionPolicy               string
+	archiveRetention             time.Duration
+	applicationDeletionPolicy    string
+	orphanSweepDryRun            bool
+	shadow                       bool
+	enableWebhook                bool
+	webhookPort                  int
+	webhookCertDir               string
+	webhookNamespace             string
+	webhookServiceName           string
+	webhookSecretName            string
+	webhookConfigurationName     string
+	reservedTenantNames          []string
+	applicationNamespacesBatch   time.Duration
+	applicationNamespacesRestart bool
+	appsNamespace                bool
+	argoCDAPIURL                 string
+	argoCDAPITokenSecret         string
+	argoCDAPIInsecure            bool
+	ciTokenTTL                   time.Duration
 }
 
 var (
@@ -43,6 +78,7 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(capsulev1beta2.AddToScheme(scheme))
+	utilruntime.Must(tenancyv1alpha1.AddToScheme(scheme))
 }
 
 func main() {
@@ -54,6 +90,25 @@ func main() {
 		systemTenantNamespace:        "tenants-system",
 		capsuleProxyServicePort:      9001,
 		argoCDNamespace:              "argocd",
+		configurationName:            "default",
+		tokenTTL:                     24 * time.Hour,
+		capsuleProxyCAKind:           "Secret",
+		capsuleProxyCAKey:            "ca.crt",
+		orphanSweepInterval:          time.Hour,
+		deletionPolicy:               tenancyv1alpha1.DeletionPolicyDelete,
+		archiveRetention:             30 * 24 * time.Hour,
+		applicationDeletionPolicy:    tenancyv1alpha1.ApplicationDeletionPolicyBlock,
+		webhookPort:                  9443,
+		webhookCertDir:               filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs"),
+		webhookNamespace:             os.Getenv("POD_NAMESPACE"),
+		webhookServiceName:           "tenancy-controller-webhook",
+		webhookSecretName:            "tenancy-controller-webhook-cert",
+		webhookConfigurationName:     "tenancy-controller",
+		reservedTenantNames:          webhook.DefaultReservedTenantNames,
+		applicationNamespacesBatch:   10 * time.Second,
+		applicationNamespacesRestart: true,
+		argoCDAPITokenSecret:         "tenancy-controller-argocd-token",
+		ciTokenTTL:                   30 * 24 * time.Hour,
 		logLevel:                     3,
 	}
 
@@ -66,6 +121,12 @@ func main() {
 			logger := options.logger
 			logger.Info("logging verbosity", "level", options.logLevel)
 
+			controllerOptions, err := options.controllerOptions()
+			if err != nil {
+				logger.Error(err, "invalid options")
+				os.Exit(1)
+			}
+
 			manager, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 				Scheme: scheme,
 				Metrics: metricsserver.Options{
@@ -74,6 +135,10 @@ func main() {
 				LeaderElection:         options.enableLeaderElection,
 				LeaderElectionID:       "2cadwd3jea.gelan.cloud",
 				HealthProbeBindAddress: ":10080",
+				WebhookServer: crwebhook.NewServer(crwebhook.Options{
+					Port:    options.webhookPort,
+					CertDir: options.webhookCertDir,
+				}),
 				NewClient: func(config *rest.Config, options client.Options) (client.Client, error) {
 					options.Cache.Unstructured = true
 
@@ -90,23 +155,90 @@ func main() {
 
 			ctx := ctrl.SetupSignalHandler()
 
-			if err = (&controller.TenancyController{
+			memberClusters, err := controller.NewMemberClusters(ctx, manager, options.configurationName)
+			if err != nil {
+				logger.Error(err, "unable to create member clusters")
+				os.Exit(1)
+			}
+
+			tenancyController := &controller.TenancyController{
 				Client:   manager.GetClient(),
 				Log:      ctrl.Log.WithName("controllers").WithName("Tenant"),
 				Recorder: manager.GetEventRecorderFor("tenancy-controller"),
-				Options: controller.TenancyControllerOptions{
-					CapsuleProxyServiceName:      options.capsuleProxyServiceName,
-					CapsuleProxyServiceNamespace: options.capsuleProxyServiceNamespace,
-					CapsuleProxyServicePort:      options.capsuleProxyServicePort,
-					UserTenantNamespace:          options.userTenantNamespace,
-					SystemTenantNamespace:        options.systemTenantNamespace,
-					ArgoCDNamespace:              options.argoCDNamespace,
-				},
-			}).SetupWithManager(ctx, manager); err != nil {
+				Clusters: memberClusters,
+				Shadow:   options.shadow,
+				Options:  controllerOptions,
+			}
+			if options.enableWebhook {
+				directClient, err := client.New(manager.GetConfig(), client.Options{Scheme: scheme})
+				if err != nil {
+					setupLog.Error(err, "unable to create client")
+					os.Exit(1)
+				}
+
+				// The webhook server needs the certificate when the manager starts
+				certificates := &webhook.CertificateController{
+					Client:        directClient,
+					Log:           ctrl.Log.WithName("controllers").WithName("WebhookCertificate"),
+					Namespace:     options.webhookNamespace,
+					SecretName:    options.webhookSecretName,
+					ServiceName:   options.webhookServiceName,
+					Configuration: options.webhookConfigurationName,
+					CertDir:       options.webhookCertDir,
+				}
+				if err = certificates.Ensure(ctx); err != nil {
+					setupLog.Error(err, "unable to provide webhook certificate")
+					os.Exit(1)
+				}
+				if err = certificates.SetupWithManager(manager); err != nil {
+					setupLog.Error(err, "unable to create controller", "controller", "WebhookCertificate")
+					os.Exit(1)
+				}
+
+				if err = (&webhook.TenantValidator{
+					ReservedNames: options.reservedTenantNames,
+				}).SetupWithManager(manager); err != nil {
+					setupLog.Error(err, "unable to create webhook", "webhook", "Tenant")
+					os.Exit(1)
+				}
+			}
+
+			if err = tenancyController.SetupWithManager(ctx, manager); err != nil {
 				setupLog.Error(err, "unable to create controller", "controller", "Tenant")
 				os.Exit(1)
 			}
 
+			if err = (&controller.ConfigurationController{
+				Client:  manager.GetClient(),
+				Log:     ctrl.Log.WithName("controllers").WithName("Configuration"),
+				Name:    options.configurationName,
+				Tenancy: tenancyController,
+			}).SetupWithManager(ctx, manager); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "Configuration")
+				os.Exit(1)
+			}
+
+			if err = (&controller.OrphanSweeper{
+				Tenancy:  tenancyController,
+				Log:      ctrl.Log.WithName("controllers").WithName("OrphanSweeper"),
+				Interval: options.orphanSweepInterval,
+				// Shadow mode never mutates the cluster
+				DryRun: options.orphanSweepDryRun || options.shadow,
+			}).SetupWithManager(manager); err != nil {
+				setupLog.Error(err, "unable to create orphan sweeper")
+				os.Exit(1)
+			}
+
+			if err = (&controller.ApplicationNamespaces{
+				Tenancy:       tenancyController,
+				Log:           ctrl.Log.WithName("controllers").WithName("ApplicationNamespaces"),
+				BatchInterval: options.applicationNamespacesBatch,
+				Restart:       options.applicationNamespacesRestart,
+			}).SetupWithManager(manager); err != nil {
+				setupLog.Error(err, "unable to create application namespaces")
+				os.Exit(1)
+			}
+
 			setupLog.Info("propagation manager start serving")
 
 			if err = manager.Start(ctx); err != nil {
@@ -120,14 +252,125 @@ func main() {
 
 	rootCommand.PersistentFlags().StringVar(&options.capsuleProxyServiceName, "proxy-svc-name", options.capsuleProxyServiceName, "capsule proxy service name")
 	rootCommand.PersistentFlags().StringVar(&options.capsuleProxyServiceNamespace, "proxy-svc-namespace", options.capsuleProxyServiceNamespace, "capsule proxy serice namespace")
+	rootCommand.PersistentFlags().Int32Var(&options.capsuleProxyServicePort, "proxy-svc-port", options.capsuleProxyServicePort, "capsule proxy service port")
+	rootCommand.PersistentFlags().StringVar(&options.capsuleProxyServerName, "proxy-server-name", options.capsuleProxyServerName, "server name to verify the capsule proxy certificate against (defaults to the proxy service hostname)")
+	rootCommand.PersistentFlags().StringVar(&options.capsuleProxyCAName, "proxy-ca-name", options.capsuleProxyCAName, "name of the secret or configmap holding the capsule proxy ca, the certificate is not verified if empty")
+	rootCommand.PersistentFlags().StringVar(&options.capsuleProxyCAKind, "proxy-ca-kind", options.capsuleProxyCAKind, "kind of the object holding the capsule proxy ca (Secret or ConfigMap)")
+	rootCommand.PersistentFlags().StringVar(&options.capsuleProxyCAKey, "proxy-ca-key", options.capsuleProxyCAKey, "key of the capsule proxy ca")
+	rootCommand.PersistentFlags().StringVar(&options.userTenantNamespace, "user-tenant-namespace", options.userTenantNamespace, "namespace for user tenant service accounts")
+	rootCommand.PersistentFlags().StringVar(&options.systemTenantNamespace, "system-tenant-namespace", options.systemTenantNamespace, "namespace for system tenant service accounts")
+	rootCommand.PersistentFlags().StringVar(&options.argoCDNamespace, "argocd-namespace", options.argoCDNamespace, "argocd installation namespace")
+	rootCommand.PersistentFlags().StringVar(&options.configurationName, "configuration-name", options.configurationName, "name of the TenancyControllerConfiguration to watch")
+	rootCommand.PersistentFlags().StringVar(&options.projectTemplatePath, "project-template", options.projectTemplatePath, "path to the AppProject template (defaults to the built-in template)")
+	rootCommand.PersistentFlags().DurationVar(&options.tokenTTL, "token-ttl", options.tokenTTL, "lifetime of the service account tokens requested for argocd")
+	rootCommand.PersistentFlags().StringVar(&options.deletionPolicy, "deletion-policy", options.deletionPolicy, "what happens to the artifacts of deleted tenants (Delete, Retain or Archive)")
+	rootCommand.PersistentFlags().DurationVar(&options.archiveRetention, "archive-retention", options.archiveRetention, "how long archived artifacts are kept before the orphan sweep removes them")
+	rootCommand.PersistentFlags().StringVar(&options.applicationDeletionPolicy, "application-deletion-policy", options.applicationDeletionPolicy, "whether Argo CD applications block the deletion of their tenant or are deleted with it (Block or Cascade)")
+	rootCommand.PersistentFlags().DurationVar(&options.orphanSweepInterval, "orphan-sweep-interval", options.orphanSweepInterval, "interval of the sweep removing artifacts of deleted tenants (0 disables the sweep)")
+	rootCommand.PersistentFlags().BoolVar(&options.orphanSweepDryRun, "orphan-sweep-dry-run", options.orphanSweepDryRun, "only report the artifacts of deleted tenants and expired archives instead of deleting them")
+	rootCommand.PersistentFlags().BoolVar(&options.shadow, "shadow", options.shadow, "only report the changes to the provisioned objects as Events and metrics, without applying them")
+	rootCommand.PersistentFlags().BoolVar(&options.enableWebhook, "enable-webhook", options.enableWebhook, "serve the validating webhook for tenants")
+	rootCommand.PersistentFlags().IntVar(&options.webhookPort, "webhook-port", options.webhookPort, "port the webhook server binds to")
+	rootCommand.PersistentFlags().StringVar(&options.webhookCertDir, "webhook-cert-dir", options.webhookCertDir, "directory the webhook certificate is written to")
+	rootCommand.PersistentFlags().StringVar(&options.webhookNamespace, "webhook-namespace", options.webhookNamespace, "namespace of the webhook service and certificate secret (defaults to $POD_NAMESPACE)")
+	rootCommand.PersistentFlags().StringVar(&options.webhookServiceName, "webhook-service-name", options.webhookServiceName, "name of the webhook service the certificate is issued for")
+	rootCommand.PersistentFlags().StringVar(&options.webhookSecretName, "webhook-secret-name", options.webhookSecretName, "name of the secret holding the webhook certificate")
+	rootCommand.PersistentFlags().StringVar(&options.webhookConfigurationName, "webhook-configuration-name", options.webhookConfigurationName, "name of the ValidatingWebhookConfiguration the ca is injected into")
+	rootCommand.PersistentFlags().StringSliceVar(&options.reservedTenantNames, "reserved-tenant-names", options.reservedTenantNames, "tenant names rejected by the webhook")
+	rootCommand.PersistentFlags().DurationVar(&options.applicationNamespacesBatch, "application-namespaces-batch-interval", options.applicationNamespacesBatch, "interval in which changed AppProjects are collected before application.namespaces of argo cd is updated (0 disables the updates)")
+	rootCommand.PersistentFlags().BoolVar(&options.applicationNamespacesRestart, "application-namespaces-restart", options.applicationNamespacesRestart, "restart the argo cd server and application controller after application.namespaces was updated")
+	rootCommand.PersistentFlags().BoolVar(&options.appsNamespace, "apps-namespace", options.appsNamespace, "create a <tenant>-apps namespace for the argo cd applications of each tenant")
+	rootCommand.PersistentFlags().StringVar(&options.argoCDAPIURL, "argocd-api-url", options.argoCDAPIURL, "url of the argocd server used to issue ci tokens (ci tokens are not issued if empty)")
+	rootCommand.PersistentFlags().StringVar(&options.argoCDAPITokenSecret, "argocd-api-token-secret", options.argoCDAPITokenSecret, "secret in the argocd namespace holding the api token in the key token")
+	rootCommand.PersistentFlags().BoolVar(&options.argoCDAPIInsecure, "argocd-api-insecure", options.argoCDAPIInsecure, "skip the verification of the argocd server certificate")
+	rootCommand.PersistentFlags().DurationVar(&options.ciTokenTTL, "ci-token-ttl", options.ciTokenTTL, "lifetime of the ci tokens issued for the tenants' project roles")
 	rootCommand.PersistentFlags().IntVarP(&options.logLevel, "log-level", "v", options.logLevel, "numeric log level")
 	rootCommand.PersistentFlags().StringVar(&options.metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	rootCommand.PersistentFlags().BoolVar(&options.enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 
-	err := rootCommand.Execute()
-	if err != nil {
-		panic(err)
+	rootCommand.AddCommand(renderCommand(&options))
+	rootCommand.AddCommand(auditCommand(&options))
+	rootCommand.AddCommand(explainCommand(&options))
+
+	// The error has already been printed by cobra
+	if err := rootCommand.Execute(); err != nil {
+		os.Exit(1)
 	}
 }
+
+// Validates the flags and returns the options of the TenancyController
+func (o *rootCmdFlags) controllerOptions() (controller.TenancyControllerOptions, error) {
+	// The TokenRequest API does not issue tokens valid for less than 10 minutes
+	if o.tokenTTL < 10*time.Minute {
+		return controller.TenancyControllerOptions{}, fmt.Errorf("token ttl must be at least 10m, got %s", o.tokenTTL)
+	}
+
+	switch o.deletionPolicy {
+	case tenancyv1alpha1.DeletionPolicyDelete, tenancyv1alpha1.DeletionPolicyRetain, tenancyv1alpha1.DeletionPolicyArchive:
+	default:
+		return controller.TenancyControllerOptions{}, fmt.Errorf("deletion policy must be Delete, Retain or Archive, got %q", o.deletionPolicy)
+	}
+
+	switch o.applicationDeletionPolicy {
+	case tenancyv1alpha1.ApplicationDeletionPolicyBlock, tenancyv1alpha1.ApplicationDeletionPolicyCascade:
+	default:
+		return controller.TenancyControllerOptions{}, fmt.Errorf("application deletion policy must be Block or Cascade, got %q", o.applicationDeletionPolicy)
+	}
+
+	// Tokens are re-issued when a third of their lifetime remains
+	if o.ciTokenTTL < 10*time.Minute {
+		return controller.TenancyControllerOptions{}, fmt.Errorf("ci token ttl must be at least 10m, got %s", o.ciTokenTTL)
+	}
+
+	var projectTemplate []byte
+	if o.projectTemplatePath != "" {
+		var err error
+		projectTemplate, err = os.ReadFile(o.projectTemplatePath)
+		if err != nil {
+			return controller.TenancyControllerOptions{}, fmt.Errorf("unable to read project template: %w", err)
+		}
+		if err := project.ValidateTemplate(string(projectTemplate)); err != nil {
+			return controller.TenancyControllerOptions{}, fmt.Errorf("invalid project template: %w", err)
+		}
+	}
+
+	var capsuleProxyCA *tenancyv1alpha1.CapsuleProxyCASpec
+	if o.capsuleProxyCAName != "" {
+		capsuleProxyCA = &tenancyv1alpha1.CapsuleProxyCASpec{
+			Kind: o.capsuleProxyCAKind,
+			Name: o.capsuleProxyCAName,
+			Key:  o.capsuleProxyCAKey,
+		}
+	}
+
+	var argoCDAPI *tenancyv1alpha1.ArgoCDAPISpec
+	if o.argoCDAPIURL != "" {
+		argoCDAPI = &tenancyv1alpha1.ArgoCDAPISpec{
+			URL:         o.argoCDAPIURL,
+			TokenSecret: o.argoCDAPITokenSecret,
+			TokenKey:    "token",
+			Insecure:    o.argoCDAPIInsecure,
+		}
+	}
+
+	return controller.TenancyControllerOptions{
+		CapsuleProxyServiceName:      o.capsuleProxyServiceName,
+		CapsuleProxyServiceNamespace: o.capsuleProxyServiceNamespace,
+		CapsuleProxyServicePort:      o.capsuleProxyServicePort,
+		UserTenantNamespace:          o.userTenantNamespace,
+		SystemTenantNamespace:        o.systemTenantNamespace,
+		ArgoCDNamespace:              o.argoCDNamespace,
+		ProjectTemplate:              string(projectTemplate),
+		TokenTTL:                     o.tokenTTL,
+		CapsuleProxyServerName:       o.capsuleProxyServerName,
+		CapsuleProxyCA:               capsuleProxyCA,
+		DeletionPolicy:               o.deletionPolicy,
+		ArchiveRetention:             o.archiveRetention,
+		ApplicationDeletionPolicy:    o.applicationDeletionPolicy,
+		AppsNamespace:                o.appsNamespace,
+		ArgoCDAPI:                    argoCDAPI,
+		CITokenTTL:                   o.ciTokenTTL,
+	}, nil
+}
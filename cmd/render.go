@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/pkg/controller"
+	"github.com/spf13/cobra"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/yaml"
+)
+
+// Prints the artifacts of the Tenants in the files or stdin without connecting to a cluster
+func renderCommand(options *rootCmdFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:          "render [file...]",
+		SilenceUsage: true,
+		Short:        "Print the artifacts the controller creates for the Tenants in the files (or stdin)",
+		Long: "Reads Tenants, ArgoTenantPolicies, the TenancyControllerConfiguration and any object they depend on " +
+			"(e.g. the capsule-proxy CA or the RBAC ConfigMap) from YAML files or stdin, and prints every artifact " +
+			"the controller would write for the Tenants. Tokens are rendered as " + controller.RenderedToken + ".",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			controllerOptions, err := options.controllerOptions()
+			if err != nil {
+				return err
+			}
+
+			objects, err := readObjects(args, cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+
+			artifacts, err := controller.Render(cmd.Context(), controllerOptions, options.configurationName, objects, renderClient, options.logger.WithName("render"))
+			if err != nil {
+				return err
+			}
+
+			for _, artifact := range artifacts {
+				data, err := yaml.Marshal(artifact.Object)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "---\n%s", data)
+			}
+
+			return nil
+		},
+	}
+}
+
+// Returns a fake client holding the seed objects, which collects the written objects and answers token requests offline
+func renderClient(seed []client.Object, collect func(client.Client, client.Object) error) client.Client {
+	return fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(seed...).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if err := c.Create(ctx, obj, opts...); err != nil {
+					return err
+				}
+				return collect(c, obj)
+			},
+			Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				if err := c.Update(ctx, obj, opts...); err != nil {
+					return err
+				}
+				return collect(c, obj)
+			},
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				if err := c.Patch(ctx, obj, patch, opts...); err != nil {
+					return err
+				}
+				return collect(c, obj)
+			},
+			// Tokens can not be requested offline
+			SubResourceCreate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+				if request, ok := subResource.(*authenticationv1.TokenRequest); ok {
+					request.Status.Token = controller.RenderedToken
+					return nil
+				}
+				return c.SubResource(subResourceName).Create(ctx, obj, subResource, opts...)
+			},
+		}).
+		Build()
+}
+
+// Reads the objects of the YAML or JSON documents in the files, stdin is read without files or for "-".
+// Objects of kinds known to the scheme are converted to their types.
+func readObjects(files []string, stdin io.Reader) ([]client.Object, error) {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	objects := []client.Object{}
+	for _, file := range files {
+		reader := stdin
+		if file != "-" {
+			f, err := os.Open(file)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			reader = f
+		}
+
+		decoder := utilyaml.NewYAMLOrJSONDecoder(reader, 4096)
+		for {
+			object := &unstructured.Unstructured{}
+			if err := decoder.Decode(&object.Object); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			// Empty documents
+			if len(object.Object) == 0 {
+				continue
+			}
+
+			if !scheme.Recognizes(object.GroupVersionKind()) {
+				objects = append(objects, object)
+				continue
+			}
+
+			typed, err := scheme.New(object.GroupVersionKind())
+			if err != nil {
+				return nil, err
+			}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, typed); err != nil {
+				return nil, fmt.Errorf("%s: %s %s: %w", file, object.GetKind(), object.GetName(), err)
+			}
+			objects = append(objects, typed.(client.Object))
+		}
+	}
+
+	return objects, nil
+}
@@ -0,0 +1,148 @@
+package argocd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client issues and revokes the JWT tokens of project roles through the Argo CD API
+type Client interface {
+	// Issues a token for the project role, it does not expire when expiresIn is zero
+	CreateProjectToken(ctx context.Context, project, role, id, description string, expiresIn time.Duration) (string, error)
+	// Revokes the token of the project role issued at the given unix time, tokens which do not exist are ignored
+	DeleteProjectToken(ctx context.Context, project, role, id string, issuedAt int64) error
+}
+
+type client struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+// Returns a client for the Argo CD server, authenticated with the token of an account which may update projects
+func NewClient(server string, token string, insecure bool) Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &client{
+		server: strings.TrimSuffix(server, "/"),
+		token:  token,
+		http:   &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}
+}
+
+func (c *client) CreateProjectToken(ctx context.Context, project, role, id, description string, expiresIn time.Duration) (string, error) {
+	request := struct {
+		Project     string `json:"project"`
+		Role        string `json:"role"`
+		Description string `json:"description"`
+		ExpiresIn   int64  `json:"expiresIn"`
+		ID          string `json:"id"`
+	}{
+		Project:     project,
+		Role:        role,
+		Description: description,
+		ExpiresIn:   int64(expiresIn.Seconds()),
+		ID:          id,
+	}
+	response := struct {
+		Token string `json:"token"`
+	}{}
+
+	if err := c.do(ctx, http.MethodPost, tokenPath(project, role), request, &response); err != nil {
+		return "", err
+	}
+	if response.Token == "" {
+		return "", fmt.Errorf("argo cd returned no token for role %s of project %s", role, project)
+	}
+
+	return response.Token, nil
+}
+
+func (c *client) DeleteProjectToken(ctx context.Context, project, role, id string, issuedAt int64) error {
+	path := tokenPath(project, role) + "/" + strconv.FormatInt(issuedAt, 10) + "?id=" + url.QueryEscape(id)
+
+	err := c.do(ctx, http.MethodDelete, path, nil, nil)
+	if IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func tokenPath(project, role string) string {
+	return "/api/v1/projects/" + url.PathEscape(project) + "/roles/" + url.PathEscape(role) + "/token"
+}
+
+// StatusError is returned when the Argo CD API answers with an unexpected status
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("argo cd api: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Returns whether the Argo CD API reported that the project, role or token does not exist
+func IsNotFound(err error) bool {
+	statusErr, ok := err.(*StatusError)
+	return ok && statusErr.StatusCode == http.StatusNotFound
+}
+
+func (c *client) do(ctx context.Context, method string, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.server+path, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+c.token)
+	if in != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		// Errors are returned as {"error": ..., "message": ...} by the gRPC gateway
+		message := struct {
+			Message string `json:"message"`
+		}{}
+		if json.Unmarshal(data, &message) != nil || message.Message == "" {
+			message.Message = strings.TrimSpace(string(data))
+		}
+		return &StatusError{StatusCode: response.StatusCode, Message: message.Message}
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
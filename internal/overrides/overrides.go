@@ -0,0 +1,244 @@
+package overrides
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	"github.com/gobwas/glob"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	Prefix = "argocd.capsule/"
+
+	// Comma separated repositories added to the AppProject sourceRepos
+	SourceReposAnnotation = Prefix + "source-repos"
+	// Comma separated namespaces added to the AppProject sourceNamespaces
+	SourceNamespacesAnnotation = Prefix + "source-namespaces"
+	// Comma separated <cluster-name>=<namespace> pairs added to the AppProject destinations
+	DestinationsAnnotation = Prefix + "destinations"
+	// Allows the tenant owners to exec into pods of their applications ("true" or "false")
+	ExecAnnotation = Prefix + "exec"
+	// Deletion policy of the tenant's artifacts ("Delete", "Retain" or "Archive")
+	DeletionPolicyAnnotation = Prefix + "deletion-policy"
+	// Namespace of the tenant receiving a Secret with a token of the CI project role
+	CITokenNamespaceAnnotation = Prefix + "ci-token-namespace"
+)
+
+// Overrides are the per tenant deviations declared with annotations on the Tenant
+type Overrides struct {
+	SourceRepos      []string
+	SourceNamespaces []string
+	Destinations     []Destination
+	Exec             bool
+	DeletionPolicy   string
+	CITokenNamespace string
+}
+
+// Glob characters Argo CD matches in cluster names
+const wildcards = "*?[]!"
+
+type Destination struct {
+	Name      string
+	Namespace string
+}
+
+// Parses the override annotations of the tenant. Annotations which are not in the
+// allowed list or which have an invalid value are not applied but returned as errors.
+func Parse(tenant *capsulev1beta2.Tenant, allowed []string) (*Overrides, []error) {
+	overrides := &Overrides{}
+	errs := []error{}
+
+	keys := make([]string, 0, len(tenant.Annotations))
+	for key := range tenant.Annotations {
+		if strings.HasPrefix(key, Prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := tenant.Annotations[key]
+
+		if !utils.StringSliceContains(allowed, key) {
+			errs = append(errs, fmt.Errorf("annotation %s is not allowed", key))
+			continue
+		}
+
+		switch key {
+		case SourceReposAnnotation:
+			repos, err := parseRepos(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("annotation %s: %w", key, err))
+				continue
+			}
+			overrides.SourceRepos = repos
+		case SourceNamespacesAnnotation:
+			namespaces, err := parseNamespaces(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("annotation %s: %w", key, err))
+				continue
+			}
+			overrides.SourceNamespaces = namespaces
+		case DestinationsAnnotation:
+			destinations, err := parseDestinations(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("annotation %s: %w", key, err))
+				continue
+			}
+			overrides.Destinations = destinations
+		case ExecAnnotation:
+			exec, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("annotation %s: invalid boolean %q", key, value))
+				continue
+			}
+			overrides.Exec = exec
+		case DeletionPolicyAnnotation:
+			switch value {
+			case tenancyv1alpha1.DeletionPolicyDelete, tenancyv1alpha1.DeletionPolicyRetain, tenancyv1alpha1.DeletionPolicyArchive:
+				overrides.DeletionPolicy = value
+			default:
+				errs = append(errs, fmt.Errorf("annotation %s: invalid deletion policy %q", key, value))
+				continue
+			}
+		case CITokenNamespaceAnnotation:
+			namespace := strings.TrimSpace(value)
+			if problems := validation.IsDNS1123Label(namespace); len(problems) > 0 {
+				errs = append(errs, fmt.Errorf("annotation %s: invalid namespace %q: %s", key, value, strings.Join(problems, ", ")))
+				continue
+			}
+			overrides.CITokenNamespace = namespace
+		default:
+			errs = append(errs, fmt.Errorf("annotation %s is unknown", key))
+		}
+	}
+
+	return overrides, errs
+}
+
+func splitList(value string) []string {
+	list := []string{}
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			list = append(list, element)
+		}
+	}
+	return list
+}
+
+// Repositories are URLs (or scp-like git addresses), patterns are reserved for the policies
+func parseRepos(value string) ([]string, error) {
+	repos := splitList(value)
+	for _, repo := range repos {
+		if strings.ContainsAny(repo, wildcards) {
+			return nil, fmt.Errorf("invalid repository %q: wildcards are not allowed", repo)
+		}
+		if parsed, err := url.Parse(repo); err == nil && parsed.Scheme != "" && parsed.Host != "" {
+			continue
+		}
+		if user, path, found := strings.Cut(repo, ":"); found && strings.Contains(user, "@") && path != "" && !strings.ContainsAny(user, "/ ") {
+			continue
+		}
+		return nil, fmt.Errorf("invalid repository %q, expected an URL", repo)
+	}
+	return repos, nil
+}
+
+// Namespaces are DNS labels, which also rules out the wildcards Argo CD would match
+func parseNamespaces(value string) ([]string, error) {
+	namespaces := splitList(value)
+	for _, namespace := range namespaces {
+		if problems := validation.IsDNS1123Label(namespace); len(problems) > 0 {
+			return nil, fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(problems, ", "))
+		}
+	}
+	return namespaces, nil
+}
+
+func parseDestinations(value string) ([]Destination, error) {
+	destinations := []Destination{}
+	for _, element := range splitList(value) {
+		name, namespace, found := strings.Cut(element, "=")
+		if !found || name == "" || namespace == "" {
+			return nil, fmt.Errorf("invalid destination %q, expected <cluster-name>=<namespace>", element)
+		}
+		if strings.ContainsAny(name, wildcards) {
+			return nil, fmt.Errorf("invalid destination %q: wildcards are not allowed", element)
+		}
+		if problems := validation.IsDNS1123Label(namespace); len(problems) > 0 {
+			return nil, fmt.Errorf("invalid destination %q: %s", element, strings.Join(problems, ", "))
+		}
+
+		destinations = append(destinations, Destination{Name: name, Namespace: namespace})
+	}
+	return destinations, nil
+}
+
+// Drops the source repositories, source namespaces and destinations which are not allowed for the tenant and returns
+// them as errors. sourceRepos are the repository patterns of the tenant's policy, destinations maps the Argo CD clusters
+// of the tenant to its namespaces in the cluster and sourceNamespaces are the namespaces of the tenant in the cluster
+// running Argo CD.
+func (o *Overrides) Restrict(sourceRepos []string, destinations map[string][]string, sourceNamespaces []string) []error {
+	errs := []error{}
+
+	repos := []string{}
+	for _, repo := range o.SourceRepos {
+		if !repoAllowed(sourceRepos, repo) {
+			errs = append(errs, fmt.Errorf("annotation %s: repository %s is not allowed by the tenant's policy", SourceReposAnnotation, repo))
+			continue
+		}
+		repos = append(repos, repo)
+	}
+	o.SourceRepos = repos
+
+	namespaces := []string{}
+	for _, namespace := range o.SourceNamespaces {
+		if !utils.StringSliceContains(sourceNamespaces, namespace) {
+			errs = append(errs, fmt.Errorf("annotation %s: namespace %s does not belong to the tenant", SourceNamespacesAnnotation, namespace))
+			continue
+		}
+		namespaces = append(namespaces, namespace)
+	}
+	o.SourceNamespaces = namespaces
+
+	allowed := []Destination{}
+	for _, destination := range o.Destinations {
+		clusterNamespaces, found := destinations[destination.Name]
+		if !found {
+			errs = append(errs, fmt.Errorf("annotation %s: cluster %s is not a cluster of the tenant", DestinationsAnnotation, destination.Name))
+			continue
+		}
+		if !utils.StringSliceContains(clusterNamespaces, destination.Namespace) {
+			errs = append(errs, fmt.Errorf("annotation %s: namespace %s does not belong to the tenant in cluster %s", DestinationsAnnotation, destination.Namespace, destination.Name))
+			continue
+		}
+		allowed = append(allowed, destination)
+	}
+	o.Destinations = allowed
+
+	return errs
+}
+
+// Matches the repository against the patterns like Argo CD matches sourceRepos, patterns starting with ! deny
+func repoAllowed(patterns []string, repo string) bool {
+	allowed := false
+	for _, pattern := range patterns {
+		denied, negated := strings.CutPrefix(pattern, "!")
+		compiled, err := glob.Compile(denied)
+		if err != nil || !compiled.Match(repo) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
@@ -0,0 +1,52 @@
+package overrides
+
+import (
+	"reflect"
+	"testing"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseRejectsWildcards(t *testing.T) {
+	for _, annotations := range []map[string]string{
+		{SourceNamespacesAnnotation: "*"},
+		{SourceReposAnnotation: "*"},
+		{SourceReposAnnotation: "https://git.example.com/*"},
+		{SourceReposAnnotation: "not a repository"},
+		{DestinationsAnnotation: "*=*"},
+		{DestinationsAnnotation: "solar=solar-*"},
+	} {
+		tenant := &capsulev1beta2.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "solar", Annotations: annotations}}
+		overrides, errs := Parse(tenant, []string{SourceReposAnnotation, SourceNamespacesAnnotation, DestinationsAnnotation})
+		if len(errs) != 1 || len(overrides.SourceRepos) != 0 || len(overrides.SourceNamespaces) != 0 || len(overrides.Destinations) != 0 {
+			t.Errorf("%v: parsed %+v with errors %v", annotations, overrides, errs)
+		}
+	}
+}
+
+func TestRestrict(t *testing.T) {
+	overrides := &Overrides{
+		SourceRepos:      []string{"https://git.example.com/solar/apps.git", "https://git.example.com/lunar/apps.git", "git@github.com:solar/apps.git"},
+		SourceNamespaces: []string{"solar-dev", "kube-system"},
+		Destinations: []Destination{
+			{Name: "solar", Namespace: "solar-dev"},
+			{Name: "in-cluster", Namespace: "kube-system"},
+			{Name: "solar", Namespace: "kube-system"},
+		},
+	}
+
+	errs := overrides.Restrict([]string{"https://git.example.com/*", "!https://git.example.com/lunar/*"}, map[string][]string{"solar": {"solar-dev"}}, []string{"solar-dev"})
+	if len(errs) != 5 {
+		t.Fatalf("errors = %v, want 5", errs)
+	}
+	if !reflect.DeepEqual(overrides.SourceRepos, []string{"https://git.example.com/solar/apps.git"}) {
+		t.Errorf("source repos = %v", overrides.SourceRepos)
+	}
+	if !reflect.DeepEqual(overrides.SourceNamespaces, []string{"solar-dev"}) {
+		t.Errorf("source namespaces = %v", overrides.SourceNamespaces)
+	}
+	if !reflect.DeepEqual(overrides.Destinations, []Destination{{Name: "solar", Namespace: "solar-dev"}}) {
+		t.Errorf("destinations = %v", overrides.Destinations)
+	}
+}
@@ -0,0 +1,175 @@
+package project
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/overrides"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/roles"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// AppProject is the subset of the Argo CD AppProject schema a template may render
+type AppProject struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Metadata   AppProjectMetadata `json:"metadata,omitempty"`
+	Spec       AppProjectSpec     `json:"spec"`
+}
+
+type AppProjectMetadata struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type AppProjectSpec struct {
+	Description                     string                                            `json:"description,omitempty"`
+	SourceRepos                     []string                                          `json:"sourceRepos,omitempty"`
+	SourceNamespaces                []string                                          `json:"sourceNamespaces,omitempty"`
+	Destinations                    []AppProjectDestination                           `json:"destinations,omitempty"`
+	DestinationServiceAccounts      []AppProjectDestinationServiceAccount             `json:"destinationServiceAccounts,omitempty"`
+	Roles                           []AppProjectRole                                  `json:"roles,omitempty"`
+	ClusterResourceWhitelist        []metav1.GroupKind                                `json:"clusterResourceWhitelist,omitempty"`
+	ClusterResourceBlacklist        []metav1.GroupKind                                `json:"clusterResourceBlacklist,omitempty"`
+	NamespaceResourceWhitelist      []metav1.GroupKind                                `json:"namespaceResourceWhitelist,omitempty"`
+	NamespaceResourceBlacklist      []metav1.GroupKind                                `json:"namespaceResourceBlacklist,omitempty"`
+	OrphanedResources               *tenancyv1alpha1.OrphanedResourcesMonitorSettings `json:"orphanedResources,omitempty"`
+	SyncWindows                     []AppProjectSyncWindow                            `json:"syncWindows,omitempty"`
+	SignatureKeys                   []tenancyv1alpha1.SignatureKey                    `json:"signatureKeys,omitempty"`
+	PermitOnlyProjectScopedClusters bool                                              `json:"permitOnlyProjectScopedClusters,omitempty"`
+}
+
+type AppProjectDestination struct {
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Server    string `json:"server,omitempty"`
+}
+
+type AppProjectDestinationServiceAccount struct {
+	Server                string `json:"server"`
+	Namespace             string `json:"namespace,omitempty"`
+	DefaultServiceAccount string `json:"defaultServiceAccount"`
+}
+
+type AppProjectRole struct {
+	Name        string                   `json:"name"`
+	Description string                   `json:"description,omitempty"`
+	Policies    []string                 `json:"policies,omitempty"`
+	Groups      []string                 `json:"groups,omitempty"`
+	JWTTokens   []map[string]interface{} `json:"jwtTokens,omitempty"`
+}
+
+type AppProjectSyncWindow struct {
+	Kind         string   `json:"kind,omitempty"`
+	Schedule     string   `json:"schedule,omitempty"`
+	Duration     string   `json:"duration,omitempty"`
+	Applications []string `json:"applications,omitempty"`
+	Namespaces   []string `json:"namespaces,omitempty"`
+	Clusters     []string `json:"clusters,omitempty"`
+	ManualSync   bool     `json:"manualSync,omitempty"`
+	TimeZone     string   `json:"timeZone,omitempty"`
+}
+
+// Cluster is an Argo CD cluster the tenant deploys to
+type Cluster struct {
+	Name   string
+	Server string
+	// Namespaces of the tenant in the cluster
+	Namespaces []string
+}
+
+// Renders the AppProject template for the tenant and validates the result against
+// the AppProject schema. An empty template renders the default ArgoProjectTemplate.
+func ArgoTenantProject(projectTemplate string, clusters []Cluster, tenant *capsulev1beta2.Tenant, projectRoles []roles.ArgoProjectRole, policy *tenancyv1alpha1.ArgoTenantPolicySpec) (*AppProject, error) {
+	if projectTemplate == "" {
+		projectTemplate = ArgoProjectTemplate
+	}
+
+	// Endpoint is the server of the first cluster, kept for templates written for a single cluster
+	endpoint := ""
+	if len(clusters) > 0 {
+		endpoint = clusters[0].Server
+	}
+
+	data := map[string]interface{}{
+		"Tenant":   tenant,
+		"Endpoint": endpoint,
+		"Clusters": clusters,
+		"Roles":    projectRoles,
+		"Policy":   policy,
+	}
+
+	tmpl, err := template.New("project").Funcs(template.FuncMap{
+		"toJson": toJson,
+	}).Parse(projectTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	var tpl bytes.Buffer
+	if err := tmpl.Execute(&tpl, data); err != nil {
+		return nil, err
+	}
+
+	// Strict decoding rejects unknown fields and mismatching types
+	project := &AppProject{}
+	if err := yaml.UnmarshalStrict(tpl.Bytes(), project); err != nil {
+		return nil, fmt.Errorf("invalid AppProject for tenant %s: %w", tenant.Name, err)
+	}
+
+	if project.APIVersion != "argoproj.io/v1alpha1" || project.Kind != "AppProject" {
+		return nil, fmt.Errorf("invalid AppProject for tenant %s: unexpected %s %s", tenant.Name, project.APIVersion, project.Kind)
+	}
+
+	return project, nil
+}
+
+// Renders the AppProject template for a sample tenant, so a broken template is rejected before any tenant is reconciled
+func ValidateTemplate(projectTemplate string) error {
+	tenant := &capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{Name: "sample"},
+		Spec: capsulev1beta2.TenantSpec{
+			Owners: capsulev1beta2.OwnerListSpec{{Kind: "User", Name: "sample"}},
+		},
+		Status: capsulev1beta2.TenantStatus{Namespaces: []string{"sample-dev"}},
+	}
+
+	projectRoles, err := roles.ArgoProjectRoles(tenant, nil)
+	if err != nil {
+		return err
+	}
+	clusters := []Cluster{{Name: "sample", Server: "https://sample.invalid", Namespaces: tenant.Status.Namespaces}}
+
+	_, err = ArgoTenantProject(projectTemplate, clusters, tenant, projectRoles, &tenancyv1alpha1.ArgoTenantPolicySpec{})
+	return err
+}
+
+// Overlays the tenant overrides onto the project
+func (p *AppProject) ApplyOverrides(o *overrides.Overrides) {
+	p.Spec.SourceRepos = utils.AppendUnique(p.Spec.SourceRepos, o.SourceRepos...)
+	p.Spec.SourceNamespaces = utils.AppendUnique(p.Spec.SourceNamespaces, o.SourceNamespaces...)
+	for _, destination := range o.Destinations {
+		p.Spec.Destinations = utils.AppendUnique(p.Spec.Destinations, AppProjectDestination{
+			Name:      destination.Name,
+			Namespace: destination.Namespace,
+		})
+	}
+}
+
+// Returns the spec as unstructured content
+func (p *AppProject) UnstructuredSpec() (map[string]interface{}, error) {
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(&p.Spec)
+}
+
+func toJson(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+
+	return string(data), err
+}
@@ -0,0 +1,22 @@
+package project
+
+var ArgoProjectTemplate = `apiVersion: argoproj.io/v1alpha1
+kind: AppProject
+spec:
+  description: Application Project {{ .Tenant.Name }}
+  roles: {{ toJson .Roles }}
+  sourceRepos: {{ toJson .Policy.SourceRepos }}
+  clusterResourceWhitelist: {{ toJson .Policy.ClusterResourceWhitelist }}
+  clusterResourceBlacklist: {{ toJson .Policy.ClusterResourceBlacklist }}
+  namespaceResourceWhitelist: {{ toJson .Policy.NamespaceResourceWhitelist }}
+  namespaceResourceBlacklist: {{ toJson .Policy.NamespaceResourceBlacklist }}
+  orphanedResources: {{ toJson .Policy.OrphanedResources }}
+  signatureKeys: {{ toJson .Policy.SignatureKeys }}
+  sourceNamespaces:
+    - {{ .Tenant.Name }}-*
+  destinations:
+{{- range .Clusters }}
+    - name: {{ .Name }}
+      namespace: {{ $.Tenant.Name }}-*
+      server: {{ .Server }}
+{{- end }}`
@@ -1,9 +1,10 @@
 package roles
 
 import (
-	"bytes"
-	"text/template"
+	"fmt"
 
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
 	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
 )
 
@@ -12,72 +13,209 @@ type ArgoProjectRole struct {
 	Description string   `json:"description"`
 	Groups      []string `json:"groups"`
 	Policies    []string `json:"policies"`
+	// Role of the tenant in the policy csv the groups are assigned to, not part of the AppProject
+	TenantRole string `json:"-"`
 }
 
-func ArgoOwnerPolicies(tenantName string) []string {
-	return []string{
-		"p, proj:" + tenantName + ":owners, applicationsets, *, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":owners, applications, *, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":owners, logs, get, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":owners, exec, create, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":owners, repositories, *, " + tenantName + "/*, allow",
-	}
+// ClusterRole granting owners full rights on the tenant
+const OwnerAdminClusterRole = "admin"
+
+// ClusterRole of the role bindings of the tenant's maintainers
+const MaintainerClusterRole = "tenant:maintainer"
+
+// Roles of the tenant in the policy csv
+const (
+	TenantRoleOwner      = "owner"
+	TenantRoleMaintainer = "maintainer"
+	TenantRoleNone       = "none"
+)
+
+// ClusterRoles Capsule binds to owners which do not declare any
+var DefaultOwnerClusterRoles = []string{OwnerAdminClusterRole, "capsule-namespace-deleter"}
+
+// Roles used when the configuration does not declare any
+var DefaultProjectRoles = []tenancyv1alpha1.ArgoProjectRoleSpec{
+	{
+		Name:              "owners",
+		Description:       "Project Owners",
+		OwnerClusterRoles: []string{OwnerAdminClusterRole},
+		TenantRole:        TenantRoleOwner,
+		Permissions: []tenancyv1alpha1.ArgoPermission{
+			{Resource: "applicationsets", Action: "*"},
+			{Resource: "applications", Action: "*"},
+			{Resource: "logs", Action: "get"},
+			{Resource: "exec", Action: "create"},
+			{Resource: "repositories", Action: "*"},
+		},
+	},
+	{
+		Name:              "maintainers",
+		Description:       "Project Maintainers",
+		ClusterRoles:      []string{MaintainerClusterRole},
+		OwnerClusterRoles: []string{MaintainerClusterRole, "edit"},
+		TenantRole:        TenantRoleMaintainer,
+		Permissions: []tenancyv1alpha1.ArgoPermission{
+			{Resource: "applicationsets", Action: "get"},
+			{Resource: "applicationsets", Action: "create"},
+			{Resource: "applicationsets", Action: "update"},
+			{Resource: "applicationsets", Action: "sync"},
+			{Resource: "applicationsets", Action: "override"},
+			{Resource: "applications", Action: "get"},
+			{Resource: "applications", Action: "create"},
+			{Resource: "applications", Action: "update"},
+			{Resource: "applications", Action: "sync"},
+			{Resource: "applications", Action: "override"},
+			{Resource: "repositories", Action: "*"},
+			{Resource: "logs", Action: "get"},
+			{Resource: "exec", Action: "create"},
+		},
+	},
+	{
+		Name:              "operators",
+		Description:       "Project Operators",
+		ClusterRoles:      []string{"tenant:operator"},
+		OwnerClusterRoles: []string{"tenant:operator"},
+		Permissions: []tenancyv1alpha1.ArgoPermission{
+			{Resource: "applicationsets", Action: "get"},
+			{Resource: "applicationsets", Action: "sync"},
+			{Resource: "applications", Action: "get"},
+			{Resource: "applications", Action: "sync"},
+			{Resource: "logs", Action: "get"},
+		},
+	},
+	{
+		Name:              "viewers",
+		Description:       "Project Viewers",
+		ClusterRoles:      []string{"tenant:viewer"},
+		OwnerClusterRoles: []string{"tenant:viewer", "view"},
+		Permissions: []tenancyv1alpha1.ArgoPermission{
+			{Resource: "applications", Action: "get"},
+			{Resource: "logs", Action: "get"},
+			{Resource: "repositories", Action: "get"},
+		},
+	},
 }
 
-func ArgoMaintainerPolicies(tenantName string) []string {
-	return []string{
-		"p, proj:" + tenantName + ":maintainers, applicationsets, get, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":maintainers, applicationsets, create, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":maintainers, applicationsets, update, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":maintainers, applicationsets, sync, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":maintainers, applicationsets, override, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":maintainers, applications, get, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":maintainers, applications, create, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":maintainers, applications, update, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":maintainers, applications, sync, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":maintainers, applications, override, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":maintainers, repositories, *, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":maintainers, logs, get, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":maintainers, exec, create, " + tenantName + "/*, allow",
-	}
+// Role of the tokens issued for the tenant's CI when the configuration does not declare one
+var DefaultCIRole = tenancyv1alpha1.ArgoProjectRoleSpec{
+	Name:        "ci",
+	Description: "Project CI",
+	Permissions: []tenancyv1alpha1.ArgoPermission{
+		{Resource: "applications", Action: "get"},
+		{Resource: "applications", Action: "create"},
+		{Resource: "applications", Action: "update"},
+		{Resource: "applications", Action: "sync"},
+		{Resource: "applicationsets", Action: "get"},
+	},
 }
 
-func ArgoOperatorPolicies(tenantName string) []string {
-	return []string{
-		"p, proj:" + tenantName + ":operators, applicationsets, get, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":operators, applicationsets, sync, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":operators, applications, get, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":operators, applications, sync, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":operators, logs, get, " + tenantName + "/*, allow",
+// Builds the policy lines of a project role
+func ArgoProjectPolicies(tenantName string, role tenancyv1alpha1.ArgoProjectRoleSpec) ([]string, error) {
+	policies := make([]string, 0, len(role.Permissions))
+	for _, permission := range role.Permissions {
+		effect := permission.Effect
+		if effect == "" {
+			effect = EffectAllow
+		}
+
+		policy, err := Policy{
+			Subject:  "proj:" + tenantName + ":" + role.Name,
+			Resource: permission.Resource,
+			Action:   permission.Action,
+			Object:   tenantName + "/*",
+			Effect:   effect,
+		}.Line()
+		if err != nil {
+			return nil, fmt.Errorf("role %s: %w", role.Name, err)
+		}
+		policies = append(policies, policy)
 	}
+
+	return policies, nil
 }
 
-func ArgoViewerPolicies(tenantName string) []string {
-	return []string{
-		"p, proj:" + tenantName + ":viewers, applications, get, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":viewers, logs, get, " + tenantName + "/*, allow",
-		"p, proj:" + tenantName + ":viewers, repositories, get, " + tenantName + "/*, allow",
+// Builds the project roles of a tenant and assigns the owners and role binding subjects
+func ArgoProjectRoles(tenant *capsulev1beta2.Tenant, mappings []tenancyv1alpha1.ArgoProjectRoleSpec) ([]ArgoProjectRole, error) {
+	if len(mappings) == 0 {
+		mappings = DefaultProjectRoles
 	}
-}
 
-func ArgoTenantCSV(cluster string, tenant *capsulev1beta2.Tenant) (string, error) {
+	projectRoles := make([]ArgoProjectRole, 0, len(mappings))
+	for _, mapping := range mappings {
+		policies, err := ArgoProjectPolicies(tenant.Name, mapping)
+		if err != nil {
+			return nil, err
+		}
 
-	data := map[string]interface{}{
-		"Tenant":   &tenant,
-		"Endpoint": cluster,
+		role := ArgoProjectRole{
+			Name:        mapping.Name,
+			Description: mapping.Description,
+			Policies:    policies,
+			Groups:      []string{},
+			TenantRole:  TenantRole(mapping),
+		}
+
+		for _, owner := range tenant.Spec.Owners {
+			if owner.Kind != "User" && owner.Kind != "Group" {
+				continue
+			}
+
+			if utils.StringSliceContains(mapping.OwnerClusterRoles, "*") || containsAny(mapping.OwnerClusterRoles, OwnerClusterRoles(owner)) {
+				if err := ValidateSubject(owner.Name); err != nil {
+					return nil, fmt.Errorf("role %s: owner: %w", mapping.Name, err)
+				}
+				role.Groups = utils.AppendUnique(role.Groups, owner.Name)
+			}
+		}
+
+		for _, binding := range tenant.Spec.AdditionalRoleBindings {
+			if !utils.StringSliceContains(mapping.ClusterRoles, binding.ClusterRoleName) {
+				continue
+			}
+
+			for _, subject := range binding.Subjects {
+				if subject.Kind == "User" || subject.Kind == "Group" {
+					if err := ValidateSubject(subject.Name); err != nil {
+						return nil, fmt.Errorf("role %s: subject: %w", mapping.Name, err)
+					}
+					role.Groups = utils.AppendUnique(role.Groups, subject.Name)
+				}
+			}
+		}
+
+		projectRoles = append(projectRoles, role)
 	}
 
-	// Create a new template and parse the text
-	tmpl, err := template.New("rbac").Parse(ArgoCSVTemplate)
-	if err != nil {
-		return "", err
+	return projectRoles, nil
+}
+
+// Returns the role of the tenant in the policy csv for the subjects of the project role
+func TenantRole(mapping tenancyv1alpha1.ArgoProjectRoleSpec) string {
+	switch {
+	case mapping.TenantRole != "":
+		return mapping.TenantRole
+	case utils.StringSliceContains(mapping.OwnerClusterRoles, OwnerAdminClusterRole):
+		return TenantRoleOwner
+	case utils.StringSliceContains(mapping.ClusterRoles, MaintainerClusterRole) || utils.StringSliceContains(mapping.OwnerClusterRoles, MaintainerClusterRole):
+		return TenantRoleMaintainer
+	default:
+		return TenantRoleNone
 	}
+}
 
-	// Execute the template with the data
-	var tpl bytes.Buffer
-	if err := tmpl.Execute(&tpl, data); err != nil {
-		return "", err
+// Returns the ClusterRoles the owner holds in the tenant's namespaces
+func OwnerClusterRoles(owner capsulev1beta2.OwnerSpec) []string {
+	if len(owner.ClusterRoles) == 0 {
+		return DefaultOwnerClusterRoles
 	}
+	return owner.ClusterRoles
+}
 
-	return tpl.String(), nil
+func containsAny(slice []string, elements []string) bool {
+	for _, element := range elements {
+		if utils.StringSliceContains(slice, element) {
+			return true
+		}
+	}
+	return false
 }
@@ -1,34 +1,103 @@
 package roles
 
-var ArgoCSVTemplate = `# Owner
-p, role:{{ .Tenant.Name }}-tenant-owner, repositories, get, *, allow
-p, role:{{ .Tenant.Name }}-tenant-owner, applicationsets, *, {{ .Tenant.Name }}/*, allow
-p, role:{{ .Tenant.Name }}-tenant-owner, applications, *, {{ .Tenant.Name }}/*, allow
-p, role:{{ .Tenant.Name }}-tenant-owner, clusters, list, {{ .Endpoint }}, allow
-p, role:{{ .Tenant.Name }}-tenant-owner, clusters, get, {{ .Endpoint }}, allow
-p, role:{{ .Tenant.Name }}-tenant-owner, projects, get, {{ .Tenant.Name }}, allow
-p, role:{{ .Tenant.Name }}-tenant-owner, logs, get, *, allow
-p, role:{{ .Tenant.Name }}-tenant-owner, exec, create, */*, deny
-
-# Maintainer
-p, role:{{ .Tenant.Name }}-tenant-maintainer, repositories, get, *, allow
-p, role:{{ .Tenant.Name }}-tenant-maintainer, clusters, get, *, deny
-p, role:{{ .Tenant.Name }}-tenant-maintainer, clusters, get, {{ .Tenant.Name }}, allow
-
-# Assign Owner
-{{- range .Tenant.Spec.Owners }}
-  {{- if or (eq .Kind "User") (eq .Kind "Group") }}
-g, {{ .Name }}, role:{{ $.Tenant.Name }}-tenant-owner
-  {{- end }}
-{{- end }}
-
-# Assign Maintainer
-{{- range .Tenant.Spec.AdditionalRoleBindings }}
-  {{- if eq .ClusterRoleName "tenant:maintainer" }}
-	{{- range .Subjects }}
-	  {{- if or (eq .Kind "User") (eq .Kind "Group") }}	
-g, {{ .Name }}, role:{{ $.Tenant.Name }}-tenant-maintainer
-	  {{- end }}
-	{{- end }}
-  {{- end }}
-{{- end }}`
+import (
+	"fmt"
+
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/overrides"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+)
+
+// Marks the policy csv keys managed by the controller
+const ArgoCSVHeader = "# Managed by tenancy-controller"
+
+// Mark the policy csv keys kept after their tenant was deleted, followed by the RFC 3339 time
+const (
+	ArgoCSVRetainedMarker = "# Retained at "
+	ArgoCSVArchivedMarker = "# Archived at "
+)
+
+// Builds the policy csv of a tenant granting its owners and maintainers access to the tenant's project and clusters.
+// The groups of the project roles are assigned to the owner or maintainer role by the tenant role of the project role,
+// so a subject is granted the same in the policy csv as in the AppProject.
+func ArgoTenantPolicyCSV(endpoints []string, tenant *capsulev1beta2.Tenant, projectRoles []ArgoProjectRole, tenantOverrides *overrides.Overrides) PolicyCSV {
+	ownerRole := "role:" + tenant.Name + "-tenant-owner"
+	maintainerRole := "role:" + tenant.Name + "-tenant-maintainer"
+
+	lines := PolicyCSV{
+		{Comment: fmt.Sprintf("%s for tenant %s (%s)", ArgoCSVHeader, tenant.Name, tenant.UID)},
+		{},
+		{Comment: "# Owner"},
+		allow(ownerRole, "repositories", "get", "*"),
+		allow(ownerRole, "applicationsets", "*", tenant.Name+"/*"),
+		allow(ownerRole, "applications", "*", tenant.Name+"/*"),
+	}
+	for _, endpoint := range endpoints {
+		lines = append(lines,
+			allow(ownerRole, "clusters", "list", endpoint),
+			allow(ownerRole, "clusters", "get", endpoint),
+		)
+	}
+	lines = append(lines,
+		allow(ownerRole, "projects", "get", tenant.Name),
+		allow(ownerRole, "logs", "get", "*"),
+	)
+	if tenantOverrides.Exec {
+		lines = append(lines, allow(ownerRole, "exec", "create", tenant.Name+"/*"))
+	} else {
+		lines = append(lines, deny(ownerRole, "exec", "create", "*/*"))
+	}
+
+	lines = append(lines,
+		PolicyLine{},
+		PolicyLine{Comment: "# Maintainer"},
+		allow(maintainerRole, "repositories", "get", "*"),
+		deny(maintainerRole, "clusters", "get", "*"),
+		allow(maintainerRole, "clusters", "get", tenant.Name),
+		PolicyLine{},
+		PolicyLine{Comment: "# Assign Owner"},
+	)
+	owners := []string{}
+	maintainers := []string{}
+	for _, role := range projectRoles {
+		switch role.TenantRole {
+		case TenantRoleOwner:
+			owners = utils.AppendUnique(owners, role.Groups...)
+		case TenantRoleMaintainer:
+			maintainers = utils.AppendUnique(maintainers, role.Groups...)
+		}
+	}
+	for _, owner := range owners {
+		lines = append(lines, assign(owner, ownerRole))
+	}
+
+	lines = append(lines,
+		PolicyLine{},
+		PolicyLine{Comment: "# Assign Maintainer"},
+	)
+	// Owners already read the repositories and clusters
+	for _, maintainer := range maintainers {
+		if !utils.StringSliceContains(owners, maintainer) {
+			lines = append(lines, assign(maintainer, maintainerRole))
+		}
+	}
+
+	return lines
+}
+
+// Returns the policy csv of a tenant, fails if a user or group can not be written safely
+func ArgoTenantCSV(endpoints []string, tenant *capsulev1beta2.Tenant, projectRoles []ArgoProjectRole, tenantOverrides *overrides.Overrides) (string, error) {
+	return ArgoTenantPolicyCSV(endpoints, tenant, projectRoles, tenantOverrides).Marshal()
+}
+
+func allow(subject, resource, action, object string) PolicyLine {
+	return PolicyLine{Policy: &Policy{Subject: subject, Resource: resource, Action: action, Object: object, Effect: EffectAllow}}
+}
+
+func deny(subject, resource, action, object string) PolicyLine {
+	return PolicyLine{Policy: &Policy{Subject: subject, Resource: resource, Action: action, Object: object, Effect: EffectDeny}}
+}
+
+func assign(subject, role string) PolicyLine {
+	return PolicyLine{Grouping: &Grouping{Subject: subject, Role: role}}
+}
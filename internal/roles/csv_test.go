@@ -0,0 +1,48 @@
+package roles
+
+import (
+	"reflect"
+	"testing"
+
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/overrides"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	capsuleapi "github.com/projectcapsule/capsule/pkg/api"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestArgoTenantPolicyCSVAssignments(t *testing.T) {
+	tenant := &capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{Name: "solar"},
+		Spec: capsulev1beta2.TenantSpec{
+			Owners: capsulev1beta2.OwnerListSpec{
+				{Kind: "User", Name: "admin"},
+				{Kind: "User", Name: "alice", ClusterRoles: []string{"view"}},
+				{Kind: "Group", Name: "editors", ClusterRoles: []string{"edit"}},
+			},
+			AdditionalRoleBindings: []capsuleapi.AdditionalRoleBindingsSpec{
+				{ClusterRoleName: "tenant:maintainer", Subjects: []rbacv1.Subject{{Kind: "User", Name: "bob"}, {Kind: "User", Name: "admin"}}},
+				{ClusterRoleName: "tenant:operator", Subjects: []rbacv1.Subject{{Kind: "User", Name: "carol"}}},
+			},
+		},
+	}
+
+	projectRoles, err := ArgoProjectRoles(tenant, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assigned := map[string][]string{}
+	for _, grouping := range ArgoTenantPolicyCSV(nil, tenant, projectRoles, &overrides.Overrides{}).Groupings() {
+		assigned[grouping.Role] = append(assigned[grouping.Role], grouping.Subject)
+	}
+
+	// alice is a viewer and carol an operator of the project, neither is assigned a role of the tenant
+	want := map[string][]string{
+		"role:solar-tenant-owner":      {"admin"},
+		"role:solar-tenant-maintainer": {"editors", "bob"},
+	}
+	if !reflect.DeepEqual(assigned, want) {
+		t.Fatalf("assignments = %v, want %v", assigned, want)
+	}
+}
@@ -0,0 +1,210 @@
+package roles
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/gobwas/glob"
+)
+
+// Casbin model Argo CD enforces its RBAC policies with
+const ArgoRBACModel = `[request_definition]
+r = sub, res, act, obj
+
+[policy_definition]
+p = sub, res, act, obj, eft
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = g(r.sub, p.sub) && globOrRegexMatch(r.res, p.res) && globOrRegexMatch(r.act, p.act) && globOrRegexMatch(r.obj, p.obj)
+`
+
+// Policies Argo CD defines for its built-in roles role:readonly and role:admin,
+// in sync with assets/builtin-policy.csv of Argo CD v3.0
+const ArgoBuiltinPolicy = `p, role:readonly, applications, get, */*, allow
+p, role:readonly, applicationsets, get, */*, allow
+p, role:readonly, certificates, get, *, allow
+p, role:readonly, clusters, get, *, allow
+p, role:readonly, repositories, get, *, allow
+p, role:readonly, write-repositories, get, *, allow
+p, role:readonly, projects, get, *, allow
+p, role:readonly, accounts, get, *, allow
+p, role:readonly, gpgkeys, get, *, allow
+p, role:readonly, logs, get, */*, allow
+
+p, role:admin, applications, create, */*, allow
+p, role:admin, applications, update, */*, allow
+p, role:admin, applications, update/*, */*, allow
+p, role:admin, applications, delete, */*, allow
+p, role:admin, applications, delete/*, */*, allow
+p, role:admin, applications, sync, */*, allow
+p, role:admin, applications, override, */*, allow
+p, role:admin, applications, action/*, */*, allow
+p, role:admin, applicationsets, get, */*, allow
+p, role:admin, applicationsets, create, */*, allow
+p, role:admin, applicationsets, update, */*, allow
+p, role:admin, applicationsets, delete, */*, allow
+p, role:admin, certificates, create, *, allow
+p, role:admin, certificates, update, *, allow
+p, role:admin, certificates, delete, *, allow
+p, role:admin, clusters, create, *, allow
+p, role:admin, clusters, update, *, allow
+p, role:admin, clusters, delete, *, allow
+p, role:admin, repositories, create, *, allow
+p, role:admin, repositories, update, *, allow
+p, role:admin, repositories, delete, *, allow
+p, role:admin, write-repositories, create, *, allow
+p, role:admin, write-repositories, update, *, allow
+p, role:admin, write-repositories, delete, *, allow
+p, role:admin, projects, create, *, allow
+p, role:admin, projects, update, *, allow
+p, role:admin, projects, delete, *, allow
+p, role:admin, accounts, update, *, allow
+p, role:admin, gpgkeys, create, *, allow
+p, role:admin, gpgkeys, delete, *, allow
+p, role:admin, exec, create, */*, allow
+p, role:admin, extensions, invoke, *, allow
+
+g, role:admin, role:readonly
+g, admin, role:admin`
+
+// Match modes of the policy.matchMode key of the RBAC ConfigMap
+const (
+	MatchModeGlob  = "glob"
+	MatchModeRegex = "regex"
+)
+
+// PolicySource is a policy csv and where it was read from, e.g. a key of the RBAC ConfigMap or an AppProject
+type PolicySource struct {
+	Name  string
+	Lines PolicyCSV
+}
+
+// SourcedPolicy is a policy and the source it was read from
+type SourcedPolicy struct {
+	Policy
+	Source string
+}
+
+// Enforcer evaluates requests against the policies of an Argo CD instance like Argo CD does
+type Enforcer struct {
+	enforcer    *casbin.Enforcer
+	policies    []SourcedPolicy
+	defaultRole string
+	match       func(value, pattern string) bool
+}
+
+// Explanation is the decision for a subject and the policies which matched the request
+type Explanation struct {
+	Subject string
+	Allowed bool
+	// Roles the subject holds directly or through other roles
+	Roles   []string
+	Matched []SourcedPolicy
+}
+
+// Builds an enforcer from the policy sources, the default role applies to every subject (policy.default)
+func NewEnforcer(sources []PolicySource, defaultRole string, matchMode string) (*Enforcer, error) {
+	m, err := model.NewModelFromString(ArgoRBACModel)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := casbin.NewEnforcer(m)
+	if err != nil {
+		return nil, err
+	}
+
+	enforcer := &Enforcer{enforcer: e, defaultRole: defaultRole}
+	switch matchMode {
+	case "", MatchModeGlob:
+		enforcer.match = globMatch
+	case MatchModeRegex:
+		enforcer.match = regexMatch
+	default:
+		return nil, fmt.Errorf("match mode must be %s or %s, got %q", MatchModeGlob, MatchModeRegex, matchMode)
+	}
+	e.AddFunction("globOrRegexMatch", func(args ...interface{}) (interface{}, error) {
+		value, _ := args[0].(string)
+		pattern, _ := args[1].(string)
+		return enforcer.match(value, pattern), nil
+	})
+
+	policies := [][]string{}
+	groupings := [][]string{}
+	for _, source := range sources {
+		for _, policy := range source.Lines.Policies() {
+			enforcer.policies = append(enforcer.policies, SourcedPolicy{Policy: policy, Source: source.Name})
+			policies = append(policies, []string{policy.Subject, policy.Resource, policy.Action, policy.Object, policy.Effect})
+		}
+		for _, grouping := range source.Lines.Groupings() {
+			groupings = append(groupings, []string{grouping.Subject, grouping.Role})
+		}
+	}
+
+	if _, err := e.AddPoliciesEx(policies); err != nil {
+		return nil, err
+	}
+	if _, err := e.AddGroupingPoliciesEx(groupings); err != nil {
+		return nil, err
+	}
+
+	return enforcer, nil
+}
+
+// Evaluates the request for the default role and each subject (e.g. a user and its groups). The request is
+// allowed if any of them is allowed, Argo CD does not combine the policies of several subjects.
+func (e *Enforcer) Explain(subjects []string, resource, action, object string) ([]Explanation, error) {
+	if e.defaultRole != "" {
+		subjects = append([]string{e.defaultRole}, subjects...)
+	}
+
+	explanations := make([]Explanation, 0, len(subjects))
+	for _, subject := range subjects {
+		allowed, err := e.enforcer.Enforce(subject, resource, action, object)
+		if err != nil {
+			return nil, err
+		}
+
+		roles, err := e.enforcer.GetImplicitRolesForUser(subject)
+		if err != nil {
+			return nil, err
+		}
+
+		explanation := Explanation{Subject: subject, Allowed: allowed, Roles: roles}
+		holders := append([]string{subject}, roles...)
+		for _, policy := range e.policies {
+			for _, holder := range holders {
+				if policy.Subject == holder && e.match(resource, policy.Resource) && e.match(action, policy.Action) && e.match(object, policy.Object) {
+					explanation.Matched = append(explanation.Matched, policy)
+					break
+				}
+			}
+		}
+
+		explanations = append(explanations, explanation)
+	}
+
+	return explanations, nil
+}
+
+// Argo CD compiles the pattern without separators, so * matches / as well
+func globMatch(value, pattern string) bool {
+	compiled, err := glob.Compile(pattern)
+	if err != nil {
+		return false
+	}
+	return compiled.Match(value)
+}
+
+func regexMatch(value, pattern string) bool {
+	matched, err := regexp.MatchString(pattern, value)
+	return err == nil && matched
+}
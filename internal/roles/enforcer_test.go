@@ -0,0 +1,34 @@
+package roles
+
+import "testing"
+
+func TestArgoBuiltinPolicy(t *testing.T) {
+	builtin, err := ParsePolicyCSV(ArgoBuiltinPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enforcer, err := NewEnforcer([]PolicySource{{Name: "builtin", Lines: builtin}}, "", MatchModeGlob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, request := range []struct {
+		subject, resource, action, object string
+		allowed                           bool
+	}{
+		{"role:readonly", "applicationsets", "get", "solar/apps", true},
+		{"role:readonly", "write-repositories", "get", "https://git.example.com/solar", true},
+		{"role:readonly", "write-repositories", "create", "https://git.example.com/solar", false},
+		{"role:admin", "write-repositories", "create", "https://git.example.com/solar", true},
+		{"role:admin", "extensions", "invoke", "metrics", true},
+		{"role:readonly", "extensions", "invoke", "metrics", false},
+	} {
+		explanations, err := enforcer.Explain([]string{request.subject}, request.resource, request.action, request.object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if explanations[0].Allowed != request.allowed {
+			t.Errorf("%s %s %s %s: allowed = %t, want %t", request.subject, request.action, request.resource, request.object, !request.allowed, request.allowed)
+		}
+	}
+}
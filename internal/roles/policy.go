@@ -0,0 +1,207 @@
+package roles
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Effects of a policy
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Policy grants or denies a subject an action on the objects of a resource,
+// e.g. `p, role:solar-tenant-owner, applications, *, solar/*, allow`
+type Policy struct {
+	Subject  string
+	Resource string
+	Action   string
+	Object   string
+	Effect   string
+}
+
+// Grouping assigns a user, group or role to a role, e.g. `g, solar-admins, role:solar-tenant-owner`
+type Grouping struct {
+	Subject string
+	Role    string
+}
+
+// PolicyLine is a line of a policy csv, either a Policy, a Grouping or a comment (empty for blank lines)
+type PolicyLine struct {
+	Policy   *Policy
+	Grouping *Grouping
+	Comment  string
+}
+
+// PolicyCSV is the content of a policy csv key of the Argo CD RBAC ConfigMap
+type PolicyCSV []PolicyLine
+
+// Returns the policy line, fields are validated and quoted where necessary
+func (p Policy) Line() (string, error) {
+	if p.Effect != EffectAllow && p.Effect != EffectDeny {
+		return "", fmt.Errorf("effect must be %s or %s, got %q", EffectAllow, EffectDeny, p.Effect)
+	}
+
+	return policyLine("p", []string{"subject", "resource", "action", "object", "effect"}, []string{p.Subject, p.Resource, p.Action, p.Object, p.Effect})
+}
+
+// Prefixes of the role names of Argo CD, users and groups named alike would be taken for the role
+const (
+	RolePrefix    = "role:"
+	ProjectPrefix = "proj:"
+)
+
+// Returns the grouping line, fields are validated and quoted where necessary
+func (g Grouping) Line() (string, error) {
+	if err := ValidateSubject(g.Subject); err != nil {
+		return "", fmt.Errorf("g subject: %w", err)
+	}
+
+	return policyLine("g", []string{"subject", "role"}, []string{g.Subject, g.Role})
+}
+
+// Validates the name of a user or group assigned to a role. Names with the prefix of a role would make Casbin
+// treat the role as member of another role, which grants it the permissions of e.g. another tenant's role.
+func ValidateSubject(name string) error {
+	if _, err := policyField(name); err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(name, RolePrefix) || strings.HasPrefix(name, ProjectPrefix) {
+		return fmt.Errorf("%q must not start with %s or %s", name, RolePrefix, ProjectPrefix)
+	}
+
+	return nil
+}
+
+// Returns the content of the policy csv, fails on the first invalid line
+func (c PolicyCSV) Marshal() (string, error) {
+	lines := make([]string, 0, len(c))
+	for idx, line := range c {
+		var text string
+		var err error
+		switch {
+		case line.Policy != nil:
+			text, err = line.Policy.Line()
+		case line.Grouping != nil:
+			text, err = line.Grouping.Line()
+		default:
+			text, err = commentLine(line.Comment)
+		}
+		if err != nil {
+			return "", fmt.Errorf("line %d: %w", idx+1, err)
+		}
+		lines = append(lines, text)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// Parses a policy csv the way Argo CD loads it: every line is trimmed, empty lines and lines starting
+// with # are skipped and the remaining lines are read as csv records with 6 fields for p and 3 for g.
+func ParsePolicyCSV(data string) (PolicyCSV, error) {
+	lines := PolicyCSV{}
+	for idx, text := range strings.Split(data, "\n") {
+		text = strings.TrimSpace(text)
+		if text == "" || strings.HasPrefix(text, "#") {
+			lines = append(lines, PolicyLine{Comment: text})
+			continue
+		}
+
+		reader := csv.NewReader(strings.NewReader(text))
+		reader.TrimLeadingSpace = true
+		fields, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", idx+1, err)
+		}
+
+		switch {
+		case fields[0] == "p" && len(fields) == 6:
+			lines = append(lines, PolicyLine{Policy: &Policy{Subject: fields[1], Resource: fields[2], Action: fields[3], Object: fields[4], Effect: fields[5]}})
+		case fields[0] == "g" && len(fields) == 3:
+			lines = append(lines, PolicyLine{Grouping: &Grouping{Subject: fields[1], Role: fields[2]}})
+		default:
+			return nil, fmt.Errorf("line %d: invalid policy %q", idx+1, text)
+		}
+	}
+
+	return lines, nil
+}
+
+// Returns the policies of the csv
+func (c PolicyCSV) Policies() []Policy {
+	policies := []Policy{}
+	for _, line := range c {
+		if line.Policy != nil {
+			policies = append(policies, *line.Policy)
+		}
+	}
+	return policies
+}
+
+// Returns the groupings of the csv
+func (c PolicyCSV) Groupings() []Grouping {
+	groupings := []Grouping{}
+	for _, line := range c {
+		if line.Grouping != nil {
+			groupings = append(groupings, *line.Grouping)
+		}
+	}
+	return groupings
+}
+
+func policyLine(kind string, names []string, values []string) (string, error) {
+	fields := make([]string, 0, len(values)+1)
+	fields = append(fields, kind)
+	for idx, value := range values {
+		field, err := policyField(value)
+		if err != nil {
+			return "", fmt.Errorf("%s %s: %w", kind, names[idx], err)
+		}
+		fields = append(fields, field)
+	}
+
+	return strings.Join(fields, ", "), nil
+}
+
+// Argo CD splits the policy csv into lines before reading each line as csv record, so line breaks
+// can not be quoted. Leading whitespace of a field is dropped and trailing whitespace is kept,
+// both are rejected to keep the fields unambiguous. Commas and double quotes are quoted.
+func policyField(value string) (string, error) {
+	if value == "" {
+		return "", fmt.Errorf("must not be empty")
+	}
+
+	if strings.ContainsAny(value, "\n\r") {
+		return "", fmt.Errorf("%q must not contain line breaks", value)
+	}
+
+	if !utf8.ValidString(value) {
+		return "", fmt.Errorf("%q must be valid utf-8", value)
+	}
+
+	if strings.TrimSpace(value) != value {
+		return "", fmt.Errorf("%q must not start or end with whitespace", value)
+	}
+
+	if strings.ContainsAny(value, ",\"") {
+		return `"` + strings.ReplaceAll(value, `"`, `""`) + `"`, nil
+	}
+
+	return value, nil
+}
+
+func commentLine(comment string) (string, error) {
+	if strings.ContainsAny(comment, "\n\r") {
+		return "", fmt.Errorf("comment %q must not contain line breaks", comment)
+	}
+
+	if comment != "" && !strings.HasPrefix(strings.TrimSpace(comment), "#") {
+		return "", fmt.Errorf("comment %q must start with #", comment)
+	}
+
+	return comment, nil
+}
@@ -0,0 +1,164 @@
+package roles
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPolicyCSVRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines PolicyCSV
+		want  string
+	}{
+		{
+			name: "plain",
+			lines: PolicyCSV{
+				{Comment: "# Owner"},
+				allow("role:solar-tenant-owner", "applications", "*", "solar/*"),
+				deny("role:solar-tenant-owner", "exec", "create", "*/*"),
+				{},
+				assign("solar-admins", "role:solar-tenant-owner"),
+			},
+			want: "# Owner\n" +
+				"p, role:solar-tenant-owner, applications, *, solar/*, allow\n" +
+				"p, role:solar-tenant-owner, exec, create, */*, deny\n" +
+				"\n" +
+				"g, solar-admins, role:solar-tenant-owner",
+		},
+		{
+			name:  "quoted comma",
+			lines: PolicyCSV{assign("CN=solar,OU=groups", "role:solar-tenant-owner")},
+			want:  `g, "CN=solar,OU=groups", role:solar-tenant-owner`,
+		},
+		{
+			name:  "embedded quotes",
+			lines: PolicyCSV{assign(`solar "admins"`, "role:solar-tenant-owner")},
+			want:  `g, "solar ""admins""", role:solar-tenant-owner`,
+		},
+		{
+			name:  "comma injecting a role",
+			lines: PolicyCSV{assign("alice, role:admin", "role:solar-tenant-owner")},
+			want:  `g, "alice, role:admin", role:solar-tenant-owner`,
+		},
+		{
+			name:  "inner whitespace",
+			lines: PolicyCSV{assign("solar admins", "role:solar-tenant-owner")},
+			want:  "g, solar admins, role:solar-tenant-owner",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := test.lines.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal() failed: %v", err)
+			}
+			if data != test.want {
+				t.Fatalf("Marshal() = %q, want %q", data, test.want)
+			}
+
+			parsed, err := ParsePolicyCSV(data)
+			if err != nil {
+				t.Fatalf("ParsePolicyCSV() failed: %v", err)
+			}
+			if !reflect.DeepEqual(parsed, test.lines) {
+				t.Fatalf("ParsePolicyCSV() = %+v, want %+v", parsed, test.lines)
+			}
+		})
+	}
+}
+
+func TestPolicyCSVRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines PolicyCSV
+		err   string
+	}{
+		{
+			name:  "newline",
+			lines: PolicyCSV{assign("alice\ng, bob, role:admin", "role:solar-tenant-owner")},
+			err:   "line breaks",
+		},
+		{
+			name:  "carriage return",
+			lines: PolicyCSV{assign("alice\rbob", "role:solar-tenant-owner")},
+			err:   "line breaks",
+		},
+		{
+			name:  "leading whitespace",
+			lines: PolicyCSV{assign(" alice", "role:solar-tenant-owner")},
+			err:   "whitespace",
+		},
+		{
+			name:  "trailing whitespace",
+			lines: PolicyCSV{assign("alice\t", "role:solar-tenant-owner")},
+			err:   "whitespace",
+		},
+		{
+			name:  "empty",
+			lines: PolicyCSV{allow("role:solar-tenant-owner", "applications", "", "solar/*")},
+			err:   "empty",
+		},
+		{
+			name:  "role prefix",
+			lines: PolicyCSV{assign("role:lunar-tenant-owner", "role:solar-tenant-owner")},
+			err:   "must not start with",
+		},
+		{
+			name:  "project prefix",
+			lines: PolicyCSV{assign("proj:lunar:owners", "role:solar-tenant-owner")},
+			err:   "must not start with",
+		},
+		{
+			name:  "effect",
+			lines: PolicyCSV{{Policy: &Policy{Subject: "role:solar-tenant-owner", Resource: "applications", Action: "get", Object: "solar/*", Effect: "maybe"}}},
+			err:   "effect",
+		},
+		{
+			name:  "comment",
+			lines: PolicyCSV{{Comment: "p, alice, applications, *, */*, allow"}},
+			err:   "must start with #",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.lines.Marshal()
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("Marshal() error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func FuzzPolicyField(f *testing.F) {
+	for _, seed := range []string{"alice", "CN=solar,OU=groups", `solar "admins"`, `"`, `""`, "a,b", "#admins", "solar admins", " alice", "alice\n", "ä,ö"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		field, err := policyField(value)
+		if err != nil {
+			return
+		}
+
+		line := "p, " + field + ", applications, get, solar/*, allow"
+		parsed, err := ParsePolicyCSV(line)
+		if err != nil {
+			t.Fatalf("ParsePolicyCSV(%q) failed: %v", line, err)
+		}
+
+		policies := parsed.Policies()
+		if len(policies) != 1 || len(parsed) != 1 {
+			t.Fatalf("ParsePolicyCSV(%q) = %+v, want one policy", line, parsed)
+		}
+		if policies[0].Subject != value {
+			t.Fatalf("subject = %q, want %q", policies[0].Subject, value)
+		}
+		if policies[0].Resource != "applications" || policies[0].Object != "solar/*" || policies[0].Effect != EffectAllow {
+			t.Fatalf("fields after %q changed: %+v", value, policies[0])
+		}
+	})
+}
@@ -1,6 +1,12 @@
 package utils
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
 	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/ptr"
@@ -8,6 +14,19 @@ import (
 
 const TenantType = "kubernetes.gelan.cloud/type"
 
+// Identify the tenant the provisioned artifacts belong to
+const (
+	TenantLabel         = "tenancy.gelan.cloud/tenant"
+	ClusterLabel        = "tenancy.gelan.cloud/cluster"
+	TenantUIDAnnotation = "tenancy.gelan.cloud/tenant-uid"
+)
+
+// Mark the artifacts kept after their tenant was deleted
+const (
+	RetainedAnnotation = "tenancy.gelan.cloud/retained-at"
+	ArchivedAnnotation = "tenancy.gelan.cloud/archived-at"
+)
+
 func ArgoPolicyName(tenant *capsulev1beta2.Tenant) string {
 	return "policy." + tenant.Name + ".csv"
 }
@@ -19,6 +38,13 @@ func CommonLabels() map[string]string {
 	}
 }
 
+// Returns the common labels and the label identifying the tenant
+func TenantLabels(tenant *capsulev1beta2.Tenant) map[string]string {
+	labels := CommonLabels()
+	labels[TenantLabel] = tenant.Name
+	return labels
+}
+
 func GetOwnerReference(tenant *capsulev1beta2.Tenant) metav1.OwnerReference {
 	return metav1.OwnerReference{
 		APIVersion:         tenant.APIVersion, // Ensure this is the correct APIVersion for the tenant
@@ -42,3 +68,60 @@ func StringSliceContains(slice []string, element string) bool {
 	}
 	return false
 }
+
+func AppendUnique[T comparable](slice []T, elements ...T) []T {
+	for _, element := range elements {
+		if !slices.Contains(slice, element) {
+			slice = append(slice, element)
+		}
+	}
+	return slice
+}
+
+// Returns the expiration of a JWT, nil if the token does not expire or is not a JWT.
+// The signature is not verified.
+func TokenExpiration(token string) *time.Time {
+	claims := tokenClaims(token)
+	if claims == nil || claims.Expiration == 0 {
+		return nil
+	}
+
+	expiration := time.Unix(claims.Expiration, 0)
+	return &expiration
+}
+
+// Returns the time a JWT was issued at, nil if the token has no iat claim or is not a JWT.
+// The signature is not verified.
+func TokenIssuedAt(token string) *time.Time {
+	claims := tokenClaims(token)
+	if claims == nil || claims.IssuedAt == 0 {
+		return nil
+	}
+
+	issuedAt := time.Unix(claims.IssuedAt, 0)
+	return &issuedAt
+}
+
+type jwtClaims struct {
+	Expiration int64 `json:"exp"`
+	IssuedAt   int64 `json:"iat"`
+}
+
+func tokenClaims(token string) *jwtClaims {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+
+	claims := &jwtClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil
+	}
+
+	return claims
+}
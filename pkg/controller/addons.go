@@ -4,29 +4,33 @@ import (
 	"context"
 	"encoding/json"
 	"reflect"
+	"time"
 
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/overrides"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/project"
 	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/roles"
 	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/pkg/metrics"
 	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-func (i *TenancyController) reconcileAddons(tenant *capsulev1beta2.Tenant, ctx context.Context) error {
-	return i.tenantArgoProject(tenant, ctx)
+func (i *TenancyController) reconcileAddons(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, status *tenancyv1alpha1.TenantArgoBindingStatus, ctx context.Context) error {
+	return i.tenantArgoProject(tenant, cluster, status, ctx)
 }
 
-// Creates Teanant Service Account with the given name and namespace
-func (i *TenancyController) tenantServiceAccount(tenant *capsulev1beta2.Tenant, ctx context.Context) (token string, err error) {
-	targetNamespace := i.Options.UserTenantNamespace
-	if utils.IsSystemTenant(tenant) {
-		targetNamespace = i.Options.SystemTenantNamespace
-	}
+// Creates Teanant Service Account in the tenant's cluster and returns a bound token for it
+func (i *TenancyController) tenantServiceAccount(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, ctx context.Context) (token string, err error) {
+	targetNamespace := i.serviceAccountNamespace(tenant, ctx)
 
 	accountResource := &corev1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
@@ -39,44 +43,52 @@ func (i *TenancyController) tenantServiceAccount(tenant *capsulev1beta2.Tenant,
 		},
 	}
 
-	_, err = controllerutil.CreateOrUpdate(ctx, i.Client, accountResource, func() (err error) {
-		return controllerutil.SetControllerReference(tenant, accountResource, i.Client.Scheme())
-	})
-
-	tokenResource := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      tenant.Name,
-			Namespace: targetNamespace,
-			Labels:    utils.CommonLabels(),
-			Annotations: map[string]string{
-				"kubernetes.io/service-account.name": tenant.Name,
-			},
-		},
-		Type: corev1.SecretTypeServiceAccountToken,
-	}
+	result, err := controllerutil.CreateOrUpdate(ctx, cluster.client, accountResource, func() (err error) {
+		cluster.setTenantMetadata(accountResource, tenant)
 
-	// Create Account Token
-	_, err = controllerutil.CreateOrUpdate(ctx, i.Client, tokenResource, func() (err error) {
-		return controllerutil.SetControllerReference(tenant, tokenResource, i.Client.Scheme())
+		return controllerutil.SetControllerReference(tenant, accountResource, cluster.client.Scheme())
 	})
-
-	var secret corev1.Secret
-	if err = i.Client.Get(ctx, client.ObjectKey{
-		Name:      tokenResource.Name,
-		Namespace: targetNamespace,
-	}, &secret); err != nil {
+	cluster.recordStep(tenant, StepServiceAccount, accountResource, result, err)
+	if err != nil {
 		return "", err
 	}
 
-	// Assuming the token is stored under a specific key, e.g., "token"
-	t, exists := secret.Data["token"]
-	if !exists {
+	// Tokens are requested through the TokenRequest API, remove the legacy token secret
+	legacySecret := &corev1.Secret{}
+	err = cluster.client.Get(ctx, client.ObjectKey{Name: tenant.Name, Namespace: targetNamespace}, legacySecret)
+	if client.IgnoreNotFound(err) != nil {
 		return "", err
 	}
+	if err == nil && legacySecret.Type == corev1.SecretTypeServiceAccountToken && metav1.IsControlledBy(legacySecret, tenant) {
+		if err = cluster.client.Delete(ctx, legacySecret); client.IgnoreNotFound(err) != nil {
+			return "", err
+		}
+	}
+
+	// Reuse the current token until it enters the rotation window, shadow mode does not request tokens
+	token = i.clusterSecretToken(tenant, cluster, ctx)
+	if expiration := utils.TokenExpiration(token); !i.Shadow && (expiration == nil || time.Until(*expiration) < i.options(ctx).TokenTTL/3) {
+		result = controllerutil.OperationResultUpdated
+		if token == "" {
+			result = controllerutil.OperationResultCreated
+		}
+
+		request := &authenticationv1.TokenRequest{
+			Spec: authenticationv1.TokenRequestSpec{
+				ExpirationSeconds: ptr.To(int64(i.options(ctx).TokenTTL.Seconds())),
+			},
+		}
+		err = cluster.client.SubResource("token").Create(ctx, accountResource, request)
+		cluster.recordStep(tenant, StepToken, accountResource, result, err)
+		if err != nil {
+			return "", err
+		}
 
-	token = string(t)
+		token = request.Status.Token
+		metrics.TokenRotations.Inc()
+	}
 
-	err = i.addServiceAccountOwner(accountResource.Namespace, tenant.Name, tenant, ctx)
+	err = i.addServiceAccountOwner(accountResource.Namespace, tenant.Name, tenant, cluster, ctx)
 	if err != nil {
 		return "", err
 	}
@@ -86,8 +98,8 @@ func (i *TenancyController) tenantServiceAccount(tenant *capsulev1beta2.Tenant,
 	return
 }
 
-// Creates a new services for the tenant
-func (i *TenancyController) tenantProxyService(name string, namespace string, tenant *capsulev1beta2.Tenant, ctx context.Context) error {
+// Creates a new services for the tenant of the local cluster
+func (i *TenancyController) tenantProxyService(name string, namespace string, tenant *capsulev1beta2.Tenant, cluster *tenantCluster, ctx context.Context) error {
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      name,
@@ -103,7 +115,7 @@ func (i *TenancyController) tenantProxyService(name string, namespace string, te
 				{
 					Name:       "proxy",
 					Port:       9001,
-					TargetPort: intstr.FromInt32(i.Options.CapsuleProxyServicePort),
+					TargetPort: intstr.FromInt32(i.options(ctx).CapsuleProxyServicePort),
 				},
 			},
 			Selector: map[string]string{
@@ -113,10 +125,12 @@ func (i *TenancyController) tenantProxyService(name string, namespace string, te
 		},
 	}
 
-	_, err := controllerutil.CreateOrUpdate(ctx, i.Client, service, func() error {
+	result, err := controllerutil.CreateOrUpdate(ctx, i.Client, service, func() error {
+		cluster.setTenantMetadata(service, tenant)
 
 		return controllerutil.SetControllerReference(tenant, service, i.Client.Scheme())
 	})
+	cluster.recordStep(tenant, StepProxyService, service, result, err)
 	if err != nil {
 		return err
 	}
@@ -126,207 +140,358 @@ func (i *TenancyController) tenantProxyService(name string, namespace string, te
 	return nil
 }
 
-func (i *TenancyController) tenantArgoServer(tenant *capsulev1beta2.Tenant, ctx context.Context) error {
+// Registers the tenant's cluster in the Argo CD instances, member clusters are reached through their own capsule-proxy
+func (i *TenancyController) tenantArgoServer(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, instances []tenancyv1alpha1.ArgoCDInstanceSpec, status *tenancyv1alpha1.TenantArgoBindingStatus, ctx context.Context) error {
 
-	svc, url := i.getProxyServiceName(tenant)
+	url := i.clusterEndpoint(tenant, cluster, ctx)
 
-	token, err := i.tenantServiceAccount(tenant, ctx)
-	if err != nil {
+	if err := i.removeLegacyArgoNames(tenant, cluster, ctx); err != nil {
 		return err
 	}
 
-	err = i.tenantProxyService(svc, i.Options.CapsuleProxyServiceNamespace, tenant, ctx)
+	start := time.Now()
+	token, err := i.tenantServiceAccount(tenant, cluster, ctx)
+	metrics.ObserveStep(metrics.StepServiceAccount, start, err)
 	if err != nil {
 		return err
 	}
 
-	serverSecret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      tenant.Name,
-			Namespace: i.Options.ArgoCDNamespace,
-			Labels: map[string]string{
-				"argocd.argoproj.io/secret-type": "cluster",
-			},
-		},
-		Type: corev1.SecretTypeOpaque,
-	}
+	if cluster.member == nil {
+		svc, _ := i.getProxyServiceName(tenant, ctx)
 
-	_, err = controllerutil.CreateOrUpdate(ctx, i.Client, serverSecret, func() error {
+		start = time.Now()
+		err = i.tenantProxyService(svc, i.options(ctx).CapsuleProxyServiceNamespace, tenant, cluster, ctx)
+		metrics.ObserveStep(metrics.StepProxyService, start, err)
+		if err != nil {
+			return err
+		}
+	}
 
-		extraData := map[string]interface{}{
-			"bearerToken": token,
-			"tlsClientConfig": map[string]interface{}{
-				"insecure": true,
+	for _, instance := range instances {
+		serverSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      cluster.argoName(tenant.Name),
+				Namespace: instance.Namespace,
+				Labels: map[string]string{
+					"argocd.argoproj.io/secret-type": "cluster",
+				},
 			},
+			Type: corev1.SecretTypeOpaque,
 		}
 
-		jsonData, err := json.Marshal(extraData)
+		start = time.Now()
+		tlsClientConfig, err := i.clusterTLSClientConfig(cluster, ctx)
+		if err != nil {
+			metrics.ObserveStep(metrics.StepClusterSecret, start, err)
+			cluster.recordStep(tenant, StepClusterSecret, serverSecret, controllerutil.OperationResultNone, err)
+			return err
+		}
 
-		serverSecret.StringData = map[string]string{
-			"name":   tenant.Name,
-			"server": url,
-			"config": string(jsonData),
+		result, err := controllerutil.CreateOrUpdate(ctx, i.Client, serverSecret, func() error {
+			cluster.setTenantMetadata(serverSecret, tenant)
+			serverSecret.Labels["argocd.argoproj.io/secret-type"] = "cluster"
+
+			extraData := map[string]interface{}{
+				"bearerToken":     token,
+				"tlsClientConfig": tlsClientConfig,
+			}
+
+			jsonData, err := json.Marshal(extraData)
+			if err != nil {
+				return err
+			}
+
+			// Data instead of StringData, so unchanged secrets are not updated
+			serverSecret.Data = map[string][]byte{
+				"name":   []byte(cluster.argoName(tenant.Name)),
+				"server": []byte(url),
+				"config": jsonData,
+			}
+
+			// Tenants of member clusters can not own objects in this cluster
+			if cluster.member != nil {
+				return nil
+			}
+
+			return controllerutil.SetControllerReference(tenant, serverSecret, i.Client.Scheme())
+		})
+		metrics.ObserveStep(metrics.StepClusterSecret, start, err)
+		cluster.recordStep(tenant, StepClusterSecret, serverSecret, result, err)
+		if err != nil {
+			return err
 		}
+		i.observeDrift(metrics.StepClusterSecret, client.ObjectKeyFromObject(serverSecret).String(), serverSecret.Data, result)
+		i.Log.V(5).Info("Argo Server created", "name", tenant.Name, "instance", instance.Name)
+	}
 
+	status.Endpoint = url
+	if expiration := utils.TokenExpiration(token); expiration != nil {
+		status.TokenExpirationTimestamp = &metav1.Time{Time: *expiration}
+		metrics.TokenExpiration.WithLabelValues(cluster.argoName(tenant.Name)).Set(float64(expiration.Unix()))
+	}
+
+	return nil
+}
+
+func (i *TenancyController) tenantArgoProject(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, status *tenancyv1alpha1.TenantArgoBindingStatus, ctx context.Context) error {
+
+	// The project is shared by the tenants of the same name in all clusters
+	merged, destinations, err := i.tenantDestinations(tenant.Name, ctx)
+	if err != nil {
 		return err
-	})
+	}
+	if merged == nil {
+		merged = tenant
+	}
+
+	instances, err := i.tenantInstances(merged, ctx)
 	if err != nil {
 		return err
 	}
-	i.Log.V(5).Info("Argo Server created", "name", tenant.Name)
 
-	return controllerutil.SetControllerReference(tenant, serverSecret, i.Client.Scheme())
+	err = i.tenantArgoServer(tenant, cluster, instances, status, ctx)
+	if err != nil {
+		return err
+	}
 
-}
+	policy, err := i.tenantPolicy(merged, ctx)
+	if err != nil {
+		return err
+	}
 
-func (i *TenancyController) tenantArgoProject(tenant *capsulev1beta2.Tenant, ctx context.Context) error {
+	tenantOverrides, overrideErrs := overrides.Parse(merged, i.options(ctx).AllowedOverrides)
+	clusterNamespaces := map[string][]string{}
+	for _, destination := range destinations {
+		clusterNamespaces[destination.Name] = destination.Namespaces
+	}
+	// Argo CD knows the local cluster by the tenant name, applications live in the tenant's namespaces there
+	overrideErrs = append(overrideErrs, tenantOverrides.Restrict(policy.SourceRepos, clusterNamespaces, clusterNamespaces[merged.Name])...)
+	for _, overrideErr := range overrideErrs {
+		i.Log.V(1).Info("Ignoring tenant override", "name", tenant.Name, "reason", overrideErr.Error())
+		cluster.recorder.Event(tenant, corev1.EventTypeWarning, "InvalidOverride", overrideErr.Error())
+	}
 
-	err := i.tenantArgoServer(tenant, ctx)
+	mappings := i.options(ctx).Roles
+	if len(mappings) == 0 {
+		mappings = roles.DefaultProjectRoles
+	}
+	if tenantOverrides.CITokenNamespace != "" {
+		mappings = append(append([]tenancyv1alpha1.ArgoProjectRoleSpec{}, mappings...), i.ciRole(ctx))
+	}
+
+	projectRoles, err := roles.ArgoProjectRoles(merged, mappings)
 	if err != nil {
 		return err
 	}
 
-	_, url := i.getProxyServiceName(tenant)
-
-	// Provision Argo Project
-	appProject := &unstructured.Unstructured{
-		Object: map[string]interface{}{
-			"apiVersion": "argoproj.io/v1alpha1",
-			"kind":       "AppProject",
-			"metadata": map[string]interface{}{
-				"name": tenant.Name,
-				"labels": map[string]string{
-					"app.kubernetes.io/instance": "tenancy-controller",
-					"app.kubernetes.io/name":     "tenancy-controller",
-				},
-				"namespace": "argocd", // Specify the namespace if needed
-			},
-			// Add Spec and other necessary fields following the AppProject CRD structure
-			"spec": map[string]interface{}{
-				"description": "Application Project " + tenant.Name,
-				"roles":       []roles.ArgoProjectRole{},
-			},
-		},
+	// Applications live in the cluster of Argo CD, member cluster tenants can not own namespaces in it
+	if i.options(ctx).AppsNamespace && cluster.member == nil {
+		start := time.Now()
+		err = i.tenantAppsNamespace(tenant, cluster, ctx)
+		metrics.ObserveStep(metrics.StepAppsNamespace, start, err)
+		if err != nil {
+			return err
+		}
 	}
 
-	_, err = controllerutil.CreateOrPatch(ctx, i.Client, appProject, func() error {
-		pol := []roles.ArgoProjectRole{}
+	endpoints := make([]string, 0, len(destinations))
+	for _, destination := range destinations {
+		endpoints = append(endpoints, destination.Server)
+	}
 
-		// Owners
-		owners := roles.ArgoProjectRole{
-			Name:        "owners",
-			Description: "Project Owners",
-			Policies:    roles.ArgoOwnerPolicies(tenant.Name),
-			Groups:      []string{},
+	for _, instance := range instances {
+		start := time.Now()
+		err = i.tenantAppProject(tenant, cluster, instance, merged, destinations, projectRoles, policy, tenantOverrides, ctx)
+		metrics.ObserveStep(metrics.StepAppProject, start, err)
+		if err != nil {
+			return err
 		}
-		for _, owner := range tenant.Spec.Owners {
-			if owner.Kind == "User" || owner.Kind == "Group" {
-				owners.Groups = append(owners.Groups, owner.Name)
-			}
+
+		start = time.Now()
+		err = i.tenantArgoCSV(tenant, cluster, instance, merged, endpoints, projectRoles, tenantOverrides, ctx)
+		metrics.ObserveStep(metrics.StepRBACConfigMap, start, err)
+		if err != nil {
+			return err
 		}
-		pol = append(pol, owners)
-
-		// Maintainers
-		maintainers := roles.ArgoProjectRole{
-			Name:        "maintainers",
-			Description: "Project Maintainers",
-			Policies:    roles.ArgoMaintainerPolicies(tenant.Name),
-			Groups:      []string{},
+
+		i.Log.V(5).Info("Argo Project created", "name", tenant.Name, "instance", instance.Name)
+	}
+
+	// The tokens are issued for the CI role of the projects written above
+	start := time.Now()
+	err = i.tenantCITokens(tenant, cluster, instances, status, ctx)
+	metrics.ObserveStep(metrics.StepCIToken, start, err)
+	if err != nil {
+		return err
+	}
+
+	// Remove the tenant from the instances it is no longer routed to
+	for _, instance := range i.argoInstances(ctx) {
+		if containsInstance(instances, instance.Name) {
+			continue
 		}
-		for _, binding := range tenant.Spec.AdditionalRoleBindings {
-			if binding.ClusterRoleName == "tenant:maintainer" {
-				for _, subject := range binding.Subjects {
-					if subject.Kind == "User" || subject.Kind == "Group" {
-						maintainers.Groups = append(maintainers.Groups, subject.Name)
-					}
-				}
-			}
+		if err := i.removeArgoCluster(tenant, cluster, instance, ctx); err != nil {
+			return err
 		}
-		pol = append(pol, maintainers)
-
-		// Operators
-		operators := roles.ArgoProjectRole{
-			Name:        "operators",
-			Description: "Project Operators",
-			Policies:    roles.ArgoOperatorPolicies(tenant.Name),
-			Groups:      []string{},
+		if err := i.removeArgoProject(tenant, instance, ctx); err != nil {
+			return err
 		}
-		for _, binding := range tenant.Spec.AdditionalRoleBindings {
-			if binding.ClusterRoleName == "tenant:operator" {
-				for _, subject := range binding.Subjects {
-					if subject.Kind == "User" || subject.Kind == "Group" {
-						maintainers.Groups = append(maintainers.Groups, subject.Name)
-					}
-				}
-			}
+	}
+
+	status.AppProject = tenant.Name
+	status.Instances = make([]string, 0, len(instances))
+	for _, instance := range instances {
+		status.Instances = append(status.Instances, instance.Name)
+	}
+	status.Roles = make([]tenancyv1alpha1.ArgoRoleAssignment, 0, len(projectRoles))
+	for _, role := range projectRoles {
+		status.Roles = append(status.Roles, tenancyv1alpha1.ArgoRoleAssignment{
+			Name:   role.Name,
+			Groups: role.Groups,
+		})
+	}
+
+	return nil
+}
+
+// Renders and applies the AppProject of the tenant merged across all clusters in the Argo CD instance
+func (i *TenancyController) tenantAppProject(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, instance tenancyv1alpha1.ArgoCDInstanceSpec, merged *capsulev1beta2.Tenant, destinations []project.Cluster, projectRoles []roles.ArgoProjectRole, policy *tenancyv1alpha1.ArgoTenantPolicySpec, tenantOverrides *overrides.Overrides, ctx context.Context) error {
+	// Provision Argo Project
+	appProject := &unstructured.Unstructured{}
+	appProject.SetAPIVersion("argoproj.io/v1alpha1")
+	appProject.SetKind("AppProject")
+	appProject.SetName(tenant.Name)
+	appProject.SetNamespace(instance.Namespace)
+
+	renderedProject, err := project.ArgoTenantProject(i.options(ctx).ProjectTemplate, destinations, merged, projectRoles, policy)
+	if err != nil {
+		cluster.recordStep(tenant, StepAppProject, appProject, controllerutil.OperationResultNone, err)
+		return err
+	}
+	renderedProject.ApplyOverrides(tenantOverrides)
+
+	renderedSpec, err := renderedProject.UnstructuredSpec()
+	if err != nil {
+		return err
+	}
+
+	result, err := controllerutil.CreateOrPatch(ctx, i.Client, appProject, func() error {
+		labels := appProject.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
 		}
-		pol = append(pol, operators)
-
-		// Viewers
-		viewers := roles.ArgoProjectRole{
-			Name:        "viewers",
-			Description: "Project Viewers",
-			Policies:    roles.ArgoViewerPolicies(tenant.Name),
-			Groups:      []string{},
+		for key, value := range renderedProject.Metadata.Labels {
+			labels[key] = value
 		}
-		for _, binding := range tenant.Spec.AdditionalRoleBindings {
-			if binding.ClusterRoleName == "tenant:viewer" {
-				for _, subject := range binding.Subjects {
-					if subject.Kind == "User" || subject.Kind == "Group" {
-						maintainers.Groups = append(maintainers.Groups, subject.Name)
-					}
-				}
-			}
+		// The project is shared by all clusters and identifies the merged tenant
+		for key, value := range utils.TenantLabels(merged) {
+			labels[key] = value
 		}
-		pol = append(pol, viewers)
-
-		// Add All Roles
-		appProject.Object["spec"].(map[string]interface{})["roles"] = pol
+		appProject.SetLabels(labels)
 
-		// Assign other Properties (which should not be overwriten)
-		appProject.Object["spec"].(map[string]interface{})["clusterResourceWhitelist"] = []map[string]interface{}{
-			{
-				"group": "*",
-				"kind":  "*",
-			},
+		annotations := appProject.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
 		}
-		appProject.Object["spec"].(map[string]interface{})["namespaceResourceWhitelist"] = []map[string]interface{}{
-			{
-				"group": "*",
-				"kind":  "*",
-			},
+		for key, value := range renderedProject.Metadata.Annotations {
+			annotations[key] = value
 		}
-		appProject.Object["spec"].(map[string]interface{})["sourceNamespaces"] = []string{tenant.Name + "-*"}
-		appProject.Object["spec"].(map[string]interface{})["sourceRepos"] = []string{"*"}
-		appProject.Object["spec"].(map[string]interface{})["destinations"] = []map[string]interface{}{
-			{
-				"name":      tenant.Name,
-				"namespace": tenant.Name + "-*",
-				"server":    url,
-			},
+		annotations[utils.TenantUIDAnnotation] = string(merged.UID)
+		delete(annotations, utils.RetainedAnnotation)
+		delete(annotations, utils.ArchivedAnnotation)
+		appProject.SetAnnotations(annotations)
+
+		// The rendered spec replaces the existing one, except for the tokens Argo CD issued for the roles
+		keepRoleTokens(appProject.Object, renderedSpec)
+		appProject.Object["spec"] = renderedSpec
+
+		// The project is shared by the tenant of every cluster and torn down with the last one. An owner reference
+		// would let the garbage collector delete it with the local tenant, regardless of the deletion policy.
+		references := []metav1.OwnerReference{}
+		for _, reference := range appProject.GetOwnerReferences() {
+			if reference.Kind != "Tenant" || reference.APIVersion != capsulev1beta2.GroupVersion.String() {
+				references = append(references, reference)
+			}
+		}
+		if len(references) != len(appProject.GetOwnerReferences()) {
+			appProject.SetOwnerReferences(references)
 		}
 
-		return controllerutil.SetControllerReference(tenant, appProject, i.Client.Scheme())
+		return nil
 	})
+	cluster.recordStep(tenant, StepAppProject, appProject, result, err)
 	if err != nil {
 		return err
 	}
+	i.observeDrift(metrics.StepAppProject, client.ObjectKeyFromObject(appProject).String(), renderedProject, result)
+	if result != controllerutil.OperationResultNone {
+		i.changedProjects()
+	}
 
-	rbacCSV, err := roles.ArgoTenantCSV(url, tenant)
+	return nil
+}
+
+// Copies the tokens of the roles of the live project into the roles of the same name in the spec
+func keepRoleTokens(live map[string]interface{}, spec map[string]interface{}) {
+	liveRoles, _, _ := unstructured.NestedSlice(live, "spec", "roles")
+	tokens := map[string]interface{}{}
+	for _, liveRole := range liveRoles {
+		role, ok := liveRole.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if roleTokens, found := role["jwtTokens"]; found {
+			name, _ := role["name"].(string)
+			tokens[name] = roleTokens
+		}
+	}
+
+	specRoles, _ := spec["roles"].([]interface{})
+	for _, specRole := range specRoles {
+		role, ok := specRole.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := role["name"].(string)
+		if roleTokens, found := tokens[name]; found {
+			role["jwtTokens"] = roleTokens
+		}
+	}
+}
+
+// Writes the policy csv of the tenant merged across all clusters into the RBAC ConfigMap of the Argo CD instance
+func (i *TenancyController) tenantArgoCSV(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, instance tenancyv1alpha1.ArgoCDInstanceSpec, merged *capsulev1beta2.Tenant, endpoints []string, projectRoles []roles.ArgoProjectRole, tenantOverrides *overrides.Overrides, ctx context.Context) error {
+	rbacCSV, err := roles.ArgoTenantCSV(endpoints, merged, projectRoles, tenantOverrides)
 	if err != nil {
 		return err
 	}
 
 	// Update existing configmap with new csv
-	configmap := &corev1.ConfigMap{}
-	err = i.Client.Get(ctx, client.ObjectKey{Name: "argocd-rbac-cm", Namespace: i.Options.ArgoCDNamespace}, configmap)
+	configmap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      rbacConfigMapName(instance),
+			Namespace: instance.Namespace,
+		},
+	}
+	err = i.Client.Get(ctx, client.ObjectKeyFromObject(configmap), configmap)
 	if err != nil {
+		cluster.recordStep(tenant, StepRBACPolicy, configmap, controllerutil.OperationResultNone, err)
 		return err
 	}
 
+	result := controllerutil.OperationResultNone
 	if !reflect.DeepEqual(configmap.Data[utils.ArgoPolicyName(tenant)], rbacCSV) {
+		result = controllerutil.OperationResultUpdated
+		if _, exists := configmap.Data[utils.ArgoPolicyName(tenant)]; !exists {
+			result = controllerutil.OperationResultCreated
+		}
+
 		err = retry.RetryOnConflict(retry.DefaultBackoff, func() (conflictErr error) {
 			_, conflictErr = controllerutil.CreateOrUpdate(ctx, i.Client, configmap, func() error {
+				// A ConfigMap without any policy has no data
+				if configmap.Data == nil {
+					configmap.Data = map[string]string{}
+				}
 				configmap.Data[utils.ArgoPolicyName(tenant)] = rbacCSV
 
 				return nil
@@ -334,17 +499,14 @@ func (i *TenancyController) tenantArgoProject(tenant *capsulev1beta2.Tenant, ctx
 
 			return
 		})
+		cluster.recordStep(tenant, StepRBACPolicy, configmap, result, err)
 		if err != nil {
 			return err
 		}
 	}
+	i.observeDrift(metrics.StepRBACConfigMap, client.ObjectKeyFromObject(configmap).String()+"/"+utils.ArgoPolicyName(tenant), rbacCSV, result)
 
-	i.Log.V(5).Info("Argo Project created", "name", tenant.Name)
+	metrics.RBACConfigMapSize.WithLabelValues(instance.Name).Set(float64(configMapSize(configmap)))
 
 	return nil
 }
-
-//func (i *TenancyController) tenantArgoCSV(tenant *capsulev1beta2.Tenant, ctx context.Context) error {
-//	configmap := &corev1.ConfigMap{}
-//	i.Client.Get(ctx, types.NamespacedName{Name: "argo", Namespace: i.Options.ArgoCDNamespace}, configmap)
-//}
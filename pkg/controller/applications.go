@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Finalizer making Argo CD prune the resources of a deleted Application
+const argoResourcesFinalizer = "resources-finalizer.argocd.argoproj.io"
+
+// Interval in which a tenant waiting for its Applications is reconciled again
+const applicationsRequeue = 30 * time.Second
+
+// Returns the Applications and ApplicationSets of the tenant's project which deploy to the tenant's cluster.
+// ApplicationSets and Applications without matching destination only count once the tenant is gone from every cluster.
+func (i *TenancyController) tenantApplications(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, last bool, ctx context.Context) ([]*unstructured.Unstructured, error) {
+	applications := []*unstructured.Unstructured{}
+
+	for _, kind := range []string{"ApplicationSet", "Application"} {
+		list := &unstructured.UnstructuredList{}
+		list.SetAPIVersion("argoproj.io/v1alpha1")
+		list.SetKind(kind + "List")
+		if err := i.Client.List(ctx, list); err != nil {
+			// Argo CD without ApplicationSets
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		for idx := range list.Items {
+			application := &list.Items[idx]
+
+			project, _, _ := unstructured.NestedString(application.Object, "spec", "project")
+			if kind == "ApplicationSet" {
+				project, _, _ = unstructured.NestedString(application.Object, "spec", "template", "spec", "project")
+			}
+			if project != tenant.Name {
+				continue
+			}
+
+			if !last {
+				if kind == "ApplicationSet" {
+					continue
+				}
+				name, _, _ := unstructured.NestedString(application.Object, "spec", "destination", "name")
+				server, _, _ := unstructured.NestedString(application.Object, "spec", "destination", "server")
+				if name != cluster.argoName(tenant.Name) && server != i.clusterEndpoint(tenant, cluster, ctx) {
+					continue
+				}
+			}
+
+			applications = append(applications, application)
+		}
+	}
+
+	return applications, nil
+}
+
+// Blocks the teardown while Applications of the tenant exist, or deletes them and waits until Argo CD pruned them.
+// Returns a non zero result while the teardown has to wait.
+func (i *TenancyController) finalizeApplications(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, last bool, ctx context.Context) (ctrl.Result, error) {
+	applications, err := i.tenantApplications(tenant, cluster, last, ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(applications) == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	names := make([]string, 0, len(applications))
+	for _, application := range applications {
+		names = append(names, application.GetKind()+" "+application.GetNamespace()+"/"+application.GetName())
+	}
+
+	if i.options(ctx).ApplicationDeletionPolicy != tenancyv1alpha1.ApplicationDeletionPolicyCascade {
+		message := fmt.Sprintf("Deletion blocked by %d Argo CD applications: %s", len(applications), strings.Join(names, ", "))
+		// The event is recorded once for every set of blocking applications, not on every requeue
+		changed, err := i.tenantDeletionBlocked(tenant, cluster, "ApplicationsExist", message, ctx)
+		if changed {
+			cluster.recorder.Event(tenant, corev1.EventTypeWarning, "DeletionBlocked", message)
+		}
+
+		return ctrl.Result{RequeueAfter: applicationsRequeue}, err
+	}
+
+	for _, application := range applications {
+		if !application.GetDeletionTimestamp().IsZero() {
+			continue
+		}
+
+		// Applications are pruned by Argo CD, ApplicationSets delete their Applications
+		if application.GetKind() == "Application" && !controllerutil.ContainsFinalizer(application, argoResourcesFinalizer) {
+			err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+				if err := i.Client.Get(ctx, client.ObjectKeyFromObject(application), application); err != nil {
+					return err
+				}
+				controllerutil.AddFinalizer(application, argoResourcesFinalizer)
+
+				return i.Client.Update(ctx, application)
+			})
+			if client.IgnoreNotFound(err) != nil {
+				return ctrl.Result{}, err
+			}
+		}
+
+		if err := i.Client.Delete(ctx, application); client.IgnoreNotFound(err) != nil {
+			return ctrl.Result{}, err
+		}
+		cluster.recorder.Eventf(tenant, corev1.EventTypeNormal, "ApplicationDeleted", "%s %s/%s deleted", application.GetKind(), application.GetNamespace(), application.GetName())
+	}
+
+	message := fmt.Sprintf("Waiting for Argo CD to prune %d applications: %s", len(applications), strings.Join(names, ", "))
+	i.Log.V(3).Info(message, "tenant", tenant.Name)
+
+	_, err = i.tenantDeletionBlocked(tenant, cluster, "PruningApplications", message, ctx)
+
+	return ctrl.Result{RequeueAfter: applicationsRequeue}, err
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestDeletionBlockedEvent(t *testing.T) {
+	application := func(name string) *unstructured.Unstructured {
+		application := &unstructured.Unstructured{}
+		application.SetAPIVersion("argoproj.io/v1alpha1")
+		application.SetKind("Application")
+		application.SetName(name)
+		application.SetNamespace("argocd")
+		if err := unstructured.SetNestedField(application.Object, "solar", "spec", "project"); err != nil {
+			t.Fatal(err)
+		}
+		if err := unstructured.SetNestedField(application.Object, "solar", "spec", "destination", "name"); err != nil {
+			t.Fatal(err)
+		}
+		return application
+	}
+
+	binding := &tenancyv1alpha1.TenantArgoBinding{ObjectMeta: metav1.ObjectMeta{Name: "solar"}}
+	c := newFakeClient(t, binding, application("frontend"))
+
+	recorder := record.NewFakeRecorder(10)
+	tenancy := &TenancyController{
+		Client:   c,
+		Log:      logr.Discard(),
+		Recorder: recorder,
+		Options:  TenancyControllerOptions{ApplicationDeletionPolicy: tenancyv1alpha1.ApplicationDeletionPolicyBlock},
+	}
+	tenant := &capsulev1beta2.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "solar"}}
+	cluster := tenancy.tenantCluster("")
+	ctx := context.Background()
+
+	finalize := func() {
+		t.Helper()
+		result, err := tenancy.finalizeApplications(tenant, cluster, true, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.RequeueAfter == 0 {
+			t.Fatal("deletion not blocked")
+		}
+	}
+
+	// Requeues with the same applications do not repeat the event
+	finalize()
+	finalize()
+	if len(recorder.Events) != 1 {
+		t.Fatalf("%d events recorded, want 1", len(recorder.Events))
+	}
+	<-recorder.Events
+
+	if err := c.Create(ctx, application("backend")); err != nil {
+		t.Fatal(err)
+	}
+	finalize()
+	if len(recorder.Events) != 1 {
+		t.Fatalf("%d events recorded after an application was added, want 1", len(recorder.Events))
+	}
+}
@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Outcomes of an audit
+const (
+	AuditMissing  = "Missing"
+	AuditDrifted  = "Drifted"
+	AuditOrphaned = "Orphaned"
+	AuditFailed   = "Failed"
+)
+
+// Exit codes of the audit command
+const (
+	AuditExitDrift = 1
+	AuditExitError = 2
+)
+
+// AuditItem is a provisioned object which differs from the desired state
+type AuditItem struct {
+	Status    string   `json:"status"`
+	Tenant    string   `json:"tenant"`
+	Kind      string   `json:"kind"`
+	Namespace string   `json:"namespace,omitempty"`
+	Name      string   `json:"name"`
+	Fields    []string `json:"fields,omitempty"`
+	Message   string   `json:"message,omitempty"`
+}
+
+// Kinds of the shadow diffs which are audited, other writes (e.g. to the Tenant) are ignored
+var auditedKinds = []string{"AppProject", "Secret", "Service", "ConfigMap", "Namespace"}
+
+// AuditExitCode returns the exit code of an audit which reported the items, failed tenants count as errors
+func AuditExitCode(items []AuditItem) int {
+	code := 0
+	for _, item := range items {
+		if item.Status == AuditFailed {
+			return AuditExitError
+		}
+		code = AuditExitDrift
+	}
+	return code
+}
+
+// Audit computes the desired state of every Tenant of the cluster and compares it with the live AppProjects,
+// cluster secrets, proxy Services and policy csv keys. Artifacts of deleted tenants are reported as orphaned.
+// Nothing is written, member clusters are not audited.
+func Audit(ctx context.Context, c client.Client, options TenancyControllerOptions, configurationName string, log logr.Logger) ([]AuditItem, error) {
+	tenancy := &TenancyController{
+		Client:   newShadowClient(c, log),
+		Log:      log,
+		Recorder: &record.FakeRecorder{},
+		Options:  options,
+		Shadow:   true,
+	}
+
+	configuration := &tenancyv1alpha1.TenancyControllerConfiguration{}
+	if err := c.Get(ctx, types.NamespacedName{Name: configurationName}, configuration); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+	} else if err := tenancy.configure(ctx, &configuration.Spec); err != nil {
+		return nil, err
+	}
+
+	tenants := &capsulev1beta2.TenantList{}
+	if err := c.List(ctx, tenants); err != nil {
+		return nil, err
+	}
+
+	items := []AuditItem{}
+	for _, instance := range tenancy.argoInstances(ctx) {
+		configmap := &corev1.ConfigMap{}
+		err := c.Get(ctx, client.ObjectKey{Name: rbacConfigMapName(instance), Namespace: instance.Namespace}, configmap)
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+		if err != nil {
+			items = append(items, AuditItem{Status: AuditMissing, Kind: "ConfigMap", Namespace: instance.Namespace, Name: rbacConfigMapName(instance)})
+		}
+	}
+
+	cluster := tenancy.tenantCluster("")
+	for idx := range tenants.Items {
+		tenant := &tenants.Items[idx]
+		if !tenant.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		report := &shadowReport{}
+		status := &tenancyv1alpha1.TenantArgoBindingStatus{}
+		if err := tenancy.reconcileAddons(tenant, cluster, status, context.WithValue(ctx, shadowReportKey{}, report)); err != nil {
+			// An object the tenant's artifacts depend on, such as the RBAC ConfigMap, does not exist
+			outcome := AuditFailed
+			if apierrors.IsNotFound(err) {
+				outcome = AuditMissing
+			}
+			items = append(items, AuditItem{Status: outcome, Tenant: tenant.Name, Kind: "Tenant", Name: tenant.Name, Message: err.Error()})
+		}
+
+		for _, diff := range report.diffs {
+			items = append(items, auditItems(tenant.Name, diff)...)
+		}
+	}
+
+	sweeper := &OrphanSweeper{Tenancy: tenancy, Log: log}
+	orphans, err := sweeper.orphans(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range orphans {
+		// Tenants of member clusters are unknown to the audit, kept artifacts are orphaned once their retention passed
+		if o.Cluster != "" || sweeper.kept(o) && !sweeper.expired(o, ctx) {
+			continue
+		}
+		items = append(items, AuditItem{Status: AuditOrphaned, Tenant: o.Tenant, Kind: o.Kind, Namespace: o.Namespace, Name: o.Name})
+	}
+
+	sort.SliceStable(items, func(a, b int) bool {
+		if items[a].Tenant != items[b].Tenant {
+			return items[a].Tenant < items[b].Tenant
+		}
+		return items[a].Kind < items[b].Kind
+	})
+
+	return items, nil
+}
+
+// Converts a shadow diff into audit items, the policy csv keys of the RBAC ConfigMaps are reported one by one
+func auditItems(tenant string, diff shadowDiff) []AuditItem {
+	audited := false
+	for _, kind := range auditedKinds {
+		audited = audited || kind == diff.Kind
+	}
+	if !audited {
+		return nil
+	}
+
+	item := AuditItem{Tenant: tenant, Kind: diff.Kind, Namespace: diff.Namespace, Name: diff.Name}
+	switch diff.Operation {
+	case ShadowCreate:
+		item.Status = AuditMissing
+	case ShadowDelete:
+		item.Status = AuditOrphaned
+	default:
+		item.Status = AuditDrifted
+	}
+
+	// Created and deleted ConfigMaps are reported as a whole
+	if diff.Kind != "ConfigMap" || diff.Operation != ShadowUpdate {
+		for _, change := range diff.Changes {
+			item.Fields = append(item.Fields, change.Path)
+		}
+		return []AuditItem{item}
+	}
+
+	items := []AuditItem{}
+	for _, change := range diff.Changes {
+		key, found := strings.CutPrefix(change.Path, "data[")
+		if !found {
+			continue
+		}
+
+		policy := item
+		policy.Kind = "RBACPolicy"
+		policy.Name = diff.Name + "/" + strings.TrimSuffix(key, "]")
+		if change.Live == nil {
+			policy.Status = AuditMissing
+		}
+		items = append(items, policy)
+	}
+
+	return items
+}
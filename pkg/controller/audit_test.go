@@ -0,0 +1,26 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestAuditMissingRBACConfigMap(t *testing.T) {
+	c := newFakeClient(t)
+
+	items, err := Audit(context.Background(), c, TenancyControllerOptions{ArgoCDNamespace: "argocd"}, "default", logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Status != AuditMissing || items[0].Kind != "ConfigMap" || items[0].Name != "argocd-rbac-cm" {
+		t.Fatalf("items = %+v, want the missing argocd-rbac-cm", items)
+	}
+	if code := AuditExitCode(items); code != AuditExitDrift {
+		t.Fatalf("exit code = %d, want %d", code, AuditExitDrift)
+	}
+	if code := AuditExitCode(append(items, AuditItem{Status: AuditFailed})); code != AuditExitError {
+		t.Fatalf("exit code with a failed tenant = %d, want %d", code, AuditExitError)
+	}
+}
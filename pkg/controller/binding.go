@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Reports the outcome of the addons reconciliation on the TenantArgoBinding of the tenant in its cluster
+func (i *TenancyController) tenantArgoBinding(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, status *tenancyv1alpha1.TenantArgoBindingStatus, reconcileErr error, ctx context.Context) error {
+	binding := &tenancyv1alpha1.TenantArgoBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: cluster.argoName(tenant.Name),
+		},
+	}
+
+	_, err := controllerutil.CreateOrUpdate(ctx, i.Client, binding, func() error {
+		cluster.setTenantMetadata(binding, tenant)
+
+		// Tenants of member clusters can not own objects in this cluster
+		if cluster.member != nil {
+			return nil
+		}
+
+		return controllerutil.SetControllerReference(tenant, binding, i.Client.Scheme())
+	})
+	if err != nil {
+		return err
+	}
+
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		if err := i.Client.Get(ctx, client.ObjectKeyFromObject(binding), binding); err != nil {
+			return err
+		}
+
+		binding.Status.ObservedGeneration = tenant.Generation
+		binding.Status.Cluster = cluster.name()
+
+		if reconcileErr != nil {
+			meta.SetStatusCondition(&binding.Status.Conditions, metav1.Condition{
+				Type:               tenancyv1alpha1.ConditionReady,
+				Status:             metav1.ConditionFalse,
+				Reason:             "ProvisioningFailed",
+				Message:            reconcileErr.Error(),
+				ObservedGeneration: tenant.Generation,
+			})
+			meta.SetStatusCondition(&binding.Status.Conditions, metav1.Condition{
+				Type:               tenancyv1alpha1.ConditionDegraded,
+				Status:             metav1.ConditionTrue,
+				Reason:             "ProvisioningFailed",
+				Message:            reconcileErr.Error(),
+				ObservedGeneration: tenant.Generation,
+			})
+
+			return i.Client.Status().Update(ctx, binding)
+		}
+
+		binding.Status.Endpoint = status.Endpoint
+		binding.Status.AppProject = status.AppProject
+		binding.Status.Instances = status.Instances
+		binding.Status.Roles = status.Roles
+		binding.Status.TokenExpirationTimestamp = status.TokenExpirationTimestamp
+		binding.Status.CITokenExpirationTimestamp = status.CITokenExpirationTimestamp
+		now := metav1.Now()
+		binding.Status.LastSuccessfulReconcileTime = &now
+
+		meta.SetStatusCondition(&binding.Status.Conditions, metav1.Condition{
+			Type:               tenancyv1alpha1.ConditionReady,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Provisioned",
+			Message:            "Argo CD integration is provisioned",
+			ObservedGeneration: tenant.Generation,
+		})
+		meta.SetStatusCondition(&binding.Status.Conditions, metav1.Condition{
+			Type:               tenancyv1alpha1.ConditionDegraded,
+			Status:             metav1.ConditionFalse,
+			Reason:             "Provisioned",
+			Message:            "Argo CD integration is provisioned",
+			ObservedGeneration: tenant.Generation,
+		})
+
+		return i.Client.Status().Update(ctx, binding)
+	})
+}
+
+// Reports on the TenantArgoBinding of the tenant in its cluster that its teardown is waiting.
+// Returns whether the reason or the message changed, which is always the case without a binding.
+func (i *TenancyController) tenantDeletionBlocked(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, reason string, message string, ctx context.Context) (bool, error) {
+	binding := &tenancyv1alpha1.TenantArgoBinding{}
+	changed := true
+
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		if err := i.Client.Get(ctx, client.ObjectKey{Name: cluster.argoName(tenant.Name)}, binding); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+
+		current := meta.FindStatusCondition(binding.Status.Conditions, tenancyv1alpha1.ConditionDeletionBlocked)
+		changed = current == nil || current.Status != metav1.ConditionTrue || current.Reason != reason || current.Message != message
+
+		if !meta.SetStatusCondition(&binding.Status.Conditions, metav1.Condition{
+			Type:               tenancyv1alpha1.ConditionDeletionBlocked,
+			Status:             metav1.ConditionTrue,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: tenant.Generation,
+		}) {
+			return nil
+		}
+
+		return i.Client.Status().Update(ctx, binding)
+	})
+
+	return changed, err
+}
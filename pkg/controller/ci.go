@@ -0,0 +1,274 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/argocd"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/overrides"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/roles"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Identify the Secrets holding the tokens of the CI role and the token they hold
+const (
+	CITokenInstanceLabel    = "tenancy.gelan.cloud/ci-token-instance"
+	CITokenIDAnnotation     = "tenancy.gelan.cloud/ci-token-id"
+	CITokenDigestAnnotation = "tenancy.gelan.cloud/ci-token-digest"
+)
+
+func ciSecretName(instance string) string {
+	return "argocd-ci-" + instance
+}
+
+// Returns the configured CI role or the built-in one
+func (i *TenancyController) ciRole(ctx context.Context) tenancyv1alpha1.ArgoProjectRoleSpec {
+	if role := i.options(ctx).CIRole; role != nil {
+		return *role
+	}
+	return roles.DefaultCIRole
+}
+
+// Returns a client of the Argo CD API of the instance, authenticated with the token of its token Secret
+func (i *TenancyController) argoAPI(instance tenancyv1alpha1.ArgoCDInstanceSpec, ctx context.Context) (argocd.Client, error) {
+	if i.argoClient != nil {
+		return i.argoClient(instance, ctx)
+	}
+
+	secret := &corev1.Secret{}
+	if err := i.Client.Get(ctx, client.ObjectKey{Name: instance.API.TokenSecret, Namespace: instance.Namespace}, secret); err != nil {
+		return nil, err
+	}
+
+	key := instance.API.TokenKey
+	if key == "" {
+		key = "token"
+	}
+	token := strings.TrimSpace(string(secret.Data[key]))
+	if token == "" {
+		return nil, fmt.Errorf("secret %s/%s has no token in key %s", secret.Namespace, secret.Name, key)
+	}
+
+	return argocd.NewClient(instance.API.URL, token, instance.API.Insecure), nil
+}
+
+// Issues a token of the CI role of each Argo CD instance of the tenant into a Secret in the namespace requested with
+// the ci-token-namespace annotation. The tokens of Secrets which are no longer requested are revoked.
+func (i *TenancyController) tenantCITokens(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, instances []tenancyv1alpha1.ArgoCDInstanceSpec, status *tenancyv1alpha1.TenantArgoBindingStatus, ctx context.Context) error {
+	// Shadow mode does not issue tokens
+	if i.Shadow {
+		return nil
+	}
+
+	// Invalid overrides are reported for the merged tenant
+	tenantOverrides, _ := overrides.Parse(tenant, i.options(ctx).AllowedOverrides)
+	namespace := tenantOverrides.CITokenNamespace
+	if namespace != "" && !utils.StringSliceContains(tenant.Status.Namespaces, namespace) {
+		cluster.recorder.Eventf(tenant, corev1.EventTypeWarning, "InvalidOverride", "annotation %s: namespace %s does not belong to the tenant", overrides.CITokenNamespaceAnnotation, namespace)
+		namespace = ""
+	}
+
+	desired := map[client.ObjectKey]bool{}
+	if namespace != "" {
+		for _, instance := range instances {
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ciSecretName(instance.Name),
+					Namespace: namespace,
+				},
+			}
+
+			if instance.API == nil {
+				cluster.recorder.Eventf(tenant, corev1.EventTypeWarning, StepCIToken+"Skipped", "argo instance %s has no api to issue CI tokens with", instance.Name)
+				continue
+			}
+			desired[client.ObjectKeyFromObject(secret)] = true
+
+			expiration, err := i.tenantCIToken(tenant, cluster, instance, secret, ctx)
+			if err != nil {
+				return err
+			}
+
+			if expiration != nil && (status.CITokenExpirationTimestamp == nil || expiration.Before(status.CITokenExpirationTimestamp.Time)) {
+				status.CITokenExpirationTimestamp = &metav1.Time{Time: *expiration}
+			}
+		}
+	}
+
+	secrets := &corev1.SecretList{}
+	if err := cluster.client.List(ctx, secrets, client.MatchingLabels{utils.TenantLabel: tenant.Name}, client.HasLabels{CITokenInstanceLabel}); err != nil {
+		return err
+	}
+	for idx := range secrets.Items {
+		secret := &secrets.Items[idx]
+		if desired[client.ObjectKeyFromObject(secret)] || !metav1.IsControlledBy(secret, tenant) {
+			continue
+		}
+
+		if err := i.removeCIToken(secret, cluster, ctx); err != nil {
+			cluster.recordStep(tenant, StepCIToken, secret, controllerutil.OperationResultNone, err)
+			return err
+		}
+
+		i.Log.V(5).Info("CI token revoked", "name", tenant.Name, "secret", client.ObjectKeyFromObject(secret).String())
+	}
+
+	return nil
+}
+
+// Issues a token into the Secret unless it holds a token for the same tenant, role and server which is not yet due
+// for rotation. The replaced token is revoked. Returns the expiration of the token in the Secret.
+func (i *TenancyController) tenantCIToken(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, instance tenancyv1alpha1.ArgoCDInstanceSpec, secret *corev1.Secret, ctx context.Context) (*time.Time, error) {
+	role := i.ciRole(ctx).Name
+	digest := ciTokenDigest(tenant, role, instance)
+
+	current := &corev1.Secret{}
+	err := cluster.client.Get(ctx, client.ObjectKeyFromObject(secret), current)
+	if client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	found := err == nil
+
+	if found && current.Labels[CITokenInstanceLabel] == "" {
+		err = fmt.Errorf("secret %s/%s is not managed by the controller", current.Namespace, current.Name)
+		cluster.recordStep(tenant, StepCIToken, secret, controllerutil.OperationResultNone, err)
+		return nil, err
+	}
+
+	token := string(current.Data["token"])
+	expiration := utils.TokenExpiration(token)
+	if token != "" && current.Annotations[CITokenDigestAnnotation] == digest && (expiration == nil || time.Until(*expiration) >= i.options(ctx).CITokenTTL/3) {
+		return expiration, nil
+	}
+
+	apiClient, err := i.argoAPI(instance, ctx)
+	if err != nil {
+		cluster.recordStep(tenant, StepCIToken, secret, controllerutil.OperationResultNone, err)
+		return nil, err
+	}
+
+	// Argo CD refuses to reuse the id of a token of the role
+	id := string(uuid.NewUUID())
+	description := fmt.Sprintf("CI token of tenant %s in %s", tenant.Name, secret.Namespace)
+	if cluster.member != nil {
+		description += " of cluster " + cluster.member.Name
+	}
+	issued, err := apiClient.CreateProjectToken(ctx, tenant.Name, role, id, description, i.options(ctx).CITokenTTL)
+	if err != nil {
+		cluster.recordStep(tenant, StepCIToken, secret, controllerutil.OperationResultNone, err)
+		return nil, err
+	}
+
+	result, err := controllerutil.CreateOrUpdate(ctx, cluster.client, secret, func() error {
+		cluster.setTenantMetadata(secret, tenant)
+		secret.Labels[CITokenInstanceLabel] = instance.Name
+		secret.Annotations[CITokenIDAnnotation] = id
+		secret.Annotations[CITokenDigestAnnotation] = digest
+
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = map[string][]byte{
+			"token":   []byte(issued),
+			"server":  []byte(instance.API.URL),
+			"project": []byte(tenant.Name),
+			"role":    []byte(role),
+		}
+
+		return controllerutil.SetControllerReference(tenant, secret, cluster.client.Scheme())
+	})
+	cluster.recordStep(tenant, StepCIToken, secret, result, err)
+	if err != nil {
+		// The token is not stored anywhere
+		if revokeErr := revokeToken(apiClient, tenant.Name, role, id, issued, ctx); revokeErr != nil {
+			i.Log.Error(revokeErr, "Unable to revoke CI token", "name", tenant.Name, "id", id)
+		}
+		return nil, err
+	}
+
+	// The replaced token stays valid until it expires when it can not be revoked
+	if token != "" {
+		if err := i.revokeCIToken(current, ctx); err != nil {
+			cluster.recorder.Eventf(tenant, corev1.EventTypeWarning, StepCIToken+"RevokeFailed", "revoking the replaced token of %s/%s failed: %s", current.Namespace, current.Name, err)
+		}
+	}
+
+	i.Log.V(5).Info("CI token issued", "name", tenant.Name, "instance", instance.Name, "secret", client.ObjectKeyFromObject(secret).String())
+
+	return utils.TokenExpiration(issued), nil
+}
+
+// Revokes the token of the CI Secret and deletes it
+func (i *TenancyController) removeCIToken(secret *corev1.Secret, cluster *tenantCluster, ctx context.Context) error {
+	if err := i.revokeCIToken(secret, ctx); err != nil {
+		return err
+	}
+
+	return client.IgnoreNotFound(cluster.client.Delete(ctx, secret))
+}
+
+// Revokes the token of the CI Secret through the instance which issued it. Tokens of instances which were removed
+// or lost their api expire on their own.
+func (i *TenancyController) revokeCIToken(secret *corev1.Secret, ctx context.Context) error {
+	for _, instance := range i.argoInstances(ctx) {
+		if instance.Name != secret.Labels[CITokenInstanceLabel] || instance.API == nil {
+			continue
+		}
+
+		apiClient, err := i.argoAPI(instance, ctx)
+		if err != nil {
+			return err
+		}
+
+		return revokeToken(apiClient, string(secret.Data["project"]), string(secret.Data["role"]), secret.Annotations[CITokenIDAnnotation], string(secret.Data["token"]), ctx)
+	}
+
+	return nil
+}
+
+// Argo CD identifies the tokens of a role by the time they were issued at
+func revokeToken(apiClient argocd.Client, project, role, id, token string, ctx context.Context) error {
+	issuedAt := utils.TokenIssuedAt(token)
+	if issuedAt == nil || project == "" || role == "" {
+		return nil
+	}
+
+	return apiClient.DeleteProjectToken(ctx, project, role, id, issuedAt.Unix())
+}
+
+// Tokens are re-issued when the tenant was recreated, the CI role was renamed or the instance moved to another server
+func ciTokenDigest(tenant *capsulev1beta2.Tenant, role string, instance tenancyv1alpha1.ArgoCDInstanceSpec) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{string(tenant.UID), role, instance.API.URL}, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Revokes the CI tokens of a deleted tenant, their Secrets are garbage collected with the tenant
+func (i *TenancyController) finalizeCITokens(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, ctx context.Context) error {
+	secrets := &corev1.SecretList{}
+	if err := cluster.client.List(ctx, secrets, client.MatchingLabels{utils.TenantLabel: tenant.Name}, client.HasLabels{CITokenInstanceLabel}); err != nil {
+		return err
+	}
+
+	for idx := range secrets.Items {
+		secret := &secrets.Items[idx]
+		if !metav1.IsControlledBy(secret, tenant) {
+			continue
+		}
+
+		// The token expires on its own, the teardown does not wait for the Argo CD API
+		if err := i.revokeCIToken(secret, ctx); err != nil {
+			cluster.recorder.Eventf(tenant, corev1.EventTypeWarning, StepCIToken+"RevokeFailed", "revoking the token of %s/%s failed: %s", secret.Namespace, secret.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// fakeArgoAPI serves the project token endpoints of the Argo CD API and records the requests
+type fakeArgoAPI struct {
+	mu       sync.Mutex
+	issuedAt int64
+	created  []map[string]interface{}
+	deleted  []string
+}
+
+func (f *fakeArgoAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer api-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/projects/solar/roles/ci/token":
+		request := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.created = append(f.created, request)
+
+		f.issuedAt++
+		expiresIn, _ := request["expiresIn"].(float64)
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": testJWT(f.issuedAt, time.Now().Add(time.Duration(expiresIn)*time.Second).Unix())})
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v1/projects/solar/roles/ci/token/"):
+		f.deleted = append(f.deleted, strings.TrimPrefix(r.URL.Path, "/api/v1/projects/solar/roles/ci/token/")+"?"+r.URL.RawQuery)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"not found","message":"not found"}`))
+	}
+}
+
+func testJWT(issuedAt int64, expiration int64) string {
+	claims, _ := json.Marshal(map[string]int64{"iat": issuedAt, "exp": expiration})
+	return "header." + base64.RawURLEncoding.EncodeToString(claims) + ".signature"
+}
+
+func TestTenantCITokens(t *testing.T) {
+	api := &fakeArgoAPI{issuedAt: 1000}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	tenant := &capsulev1beta2.Tenant{
+		TypeMeta: metav1.TypeMeta{APIVersion: capsulev1beta2.GroupVersion.String(), Kind: "Tenant"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "solar",
+			UID:         "solar-uid",
+			Annotations: map[string]string{"argocd.capsule/ci-token-namespace": "solar-ci"},
+		},
+		Spec: capsulev1beta2.TenantSpec{
+			Owners: capsulev1beta2.OwnerListSpec{{Kind: "User", Name: "alice"}},
+		},
+		Status: capsulev1beta2.TenantStatus{Namespaces: []string{"solar-ci"}},
+	}
+
+	c := newFakeClientBuilder(t,
+		tenant,
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "argocd-api", Namespace: "argocd"}, Data: map[string][]byte{"token": []byte("api-token")}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "argocd-rbac-cm", Namespace: "argocd"}},
+	).
+		WithInterceptorFuncs(interceptor.Funcs{
+			SubResourceCreate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+				if request, ok := subResource.(*authenticationv1.TokenRequest); ok {
+					request.Status.Token = "service-account-token"
+					return nil
+				}
+				return c.SubResource(subResourceName).Create(ctx, obj, subResource, opts...)
+			},
+		}).
+		Build()
+
+	tenancy := &TenancyController{
+		Client:   c,
+		Log:      logr.Discard(),
+		Recorder: record.NewFakeRecorder(100),
+		Options: TenancyControllerOptions{
+			ArgoCDNamespace:  "argocd",
+			AllowedOverrides: []string{"argocd.capsule/ci-token-namespace"},
+			TokenTTL:         time.Hour,
+			CITokenTTL:       time.Hour,
+			ArgoCDAPI:        &tenancyv1alpha1.ArgoCDAPISpec{URL: server.URL, TokenSecret: "argocd-api"},
+		},
+	}
+	cluster := tenancy.tenantCluster("")
+	ctx := context.Background()
+	secretKey := client.ObjectKey{Name: "argocd-ci-default", Namespace: "solar-ci"}
+
+	reconcile := func() *tenancyv1alpha1.TenantArgoBindingStatus {
+		t.Helper()
+		status := &tenancyv1alpha1.TenantArgoBindingStatus{}
+		if err := tenancy.reconcileAddons(tenant.DeepCopy(), cluster, status, ctx); err != nil {
+			t.Fatalf("reconcileAddons() failed: %v", err)
+		}
+		if err := tenancy.tenantArgoBinding(tenant, cluster, status, nil, ctx); err != nil {
+			t.Fatalf("tenantArgoBinding() failed: %v", err)
+		}
+		return status
+	}
+
+	// Issuance
+	status := reconcile()
+	if len(api.created) != 1 {
+		t.Fatalf("issued %d tokens, want 1", len(api.created))
+	}
+	if api.created[0]["project"] != "solar" || api.created[0]["role"] != "ci" || api.created[0]["expiresIn"] != float64(3600) {
+		t.Fatalf("unexpected token request %v", api.created[0])
+	}
+	if status.CITokenExpirationTimestamp == nil {
+		t.Fatal("CI token expiration not reported")
+	}
+
+	// The expiration is persisted on the binding, which schedules the next rotation
+	binding := &tenancyv1alpha1.TenantArgoBinding{}
+	if err := c.Get(ctx, client.ObjectKey{Name: "solar"}, binding); err != nil {
+		t.Fatal(err)
+	}
+	if binding.Status.CITokenExpirationTimestamp == nil || !binding.Status.CITokenExpirationTimestamp.Equal(status.CITokenExpirationTimestamp) {
+		t.Fatalf("binding reports CI token expiration %v, want %v", binding.Status.CITokenExpirationTimestamp, status.CITokenExpirationTimestamp)
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, secretKey, secret); err != nil {
+		t.Fatalf("CI token secret not written: %v", err)
+	}
+	if string(secret.Data["token"]) != testJWT(1001, status.CITokenExpirationTimestamp.Unix()) || string(secret.Data["server"]) != server.URL || string(secret.Data["role"]) != "ci" {
+		t.Fatalf("unexpected CI token secret data %v", secret.Data)
+	}
+	firstID := secret.Annotations[CITokenIDAnnotation]
+	if firstID == "" || firstID != api.created[0]["id"] {
+		t.Fatalf("token id annotation %q does not match the issued id %v", firstID, api.created[0]["id"])
+	}
+
+	// Argo CD records the issued token in the role of the AppProject
+	appProject := &unstructured.Unstructured{}
+	appProject.SetAPIVersion("argoproj.io/v1alpha1")
+	appProject.SetKind("AppProject")
+	if err := c.Get(ctx, client.ObjectKey{Name: "solar", Namespace: "argocd"}, appProject); err != nil {
+		t.Fatal(err)
+	}
+	jwtTokens := []interface{}{map[string]interface{}{"iat": int64(1001), "id": firstID}}
+	setRoleTokens(t, appProject, "ci", jwtTokens)
+	if err := c.Update(ctx, appProject); err != nil {
+		t.Fatal(err)
+	}
+
+	// The token is kept, as are the tokens in the AppProject
+	reconcile()
+	if len(api.created) != 1 || len(api.deleted) != 0 {
+		t.Fatalf("token changed without reason: created %d, deleted %v", len(api.created), api.deleted)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(appProject), appProject); err != nil {
+		t.Fatal(err)
+	}
+	if got := roleTokens(t, appProject, "ci"); fmt.Sprint(got) != fmt.Sprint(jwtTokens) {
+		t.Fatalf("jwtTokens of the ci role = %v, want %v", got, jwtTokens)
+	}
+
+	// Rotation revokes the replaced token by its iat
+	tenancy.Options.CITokenTTL = 24 * time.Hour
+	reconcile()
+	if len(api.created) != 2 {
+		t.Fatalf("issued %d tokens, want 2", len(api.created))
+	}
+	if want := []string{"1001?id=" + firstID}; fmt.Sprint(api.deleted) != fmt.Sprint(want) {
+		t.Fatalf("revoked %v, want %v", api.deleted, want)
+	}
+	if err := c.Get(ctx, secretKey, secret); err != nil {
+		t.Fatal(err)
+	}
+	secondID := secret.Annotations[CITokenIDAnnotation]
+
+	// Opting out revokes the token and deletes the Secret
+	if err := c.Get(ctx, client.ObjectKeyFromObject(tenant), tenant); err != nil {
+		t.Fatal(err)
+	}
+	delete(tenant.Annotations, "argocd.capsule/ci-token-namespace")
+	if err := c.Update(ctx, tenant); err != nil {
+		t.Fatal(err)
+	}
+	status = reconcile()
+	if want := []string{"1001?id=" + firstID, "1002?id=" + secondID}; fmt.Sprint(api.deleted) != fmt.Sprint(want) {
+		t.Fatalf("revoked %v, want %v", api.deleted, want)
+	}
+	if err := c.Get(ctx, secretKey, secret); !apierrors.IsNotFound(err) {
+		t.Fatalf("CI token secret not deleted: %v", err)
+	}
+	if status.CITokenExpirationTimestamp != nil {
+		t.Fatal("CI token expiration reported after opting out")
+	}
+	if err := c.Get(ctx, client.ObjectKey{Name: "solar"}, binding); err != nil {
+		t.Fatal(err)
+	}
+	if binding.Status.CITokenExpirationTimestamp != nil {
+		t.Fatal("binding reports a CI token expiration after opting out")
+	}
+}
+
+func roleTokens(t *testing.T, appProject *unstructured.Unstructured, name string) interface{} {
+	t.Helper()
+	projectRoles, _, _ := unstructured.NestedSlice(appProject.Object, "spec", "roles")
+	for _, projectRole := range projectRoles {
+		role := projectRole.(map[string]interface{})
+		if role["name"] == name {
+			return role["jwtTokens"]
+		}
+	}
+	t.Fatalf("AppProject has no role %s", name)
+	return nil
+}
+
+func setRoleTokens(t *testing.T, appProject *unstructured.Unstructured, name string, tokens []interface{}) {
+	t.Helper()
+	projectRoles, _, _ := unstructured.NestedSlice(appProject.Object, "spec", "roles")
+	for _, projectRole := range projectRoles {
+		role := projectRole.(map[string]interface{})
+		if role["name"] == name {
+			role["jwtTokens"] = tokens
+		}
+	}
+	if err := unstructured.SetNestedSlice(appProject.Object, projectRoles, "spec", "roles"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,337 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/overrides"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/project"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// MemberCluster is a cluster whose Tenants are registered in the Argo CD of the hub cluster
+type MemberCluster struct {
+	Name            string
+	Cluster         cluster.Cluster
+	ProxyEndpoint   string
+	ProxyServerName string
+	ProxyCA         []byte
+}
+
+// Creates the member clusters of the configuration and adds them to the manager.
+// Member clusters are only read at startup, the cache of the manager is not started yet.
+func NewMemberClusters(ctx context.Context, mgr ctrl.Manager, configurationName string) ([]MemberCluster, error) {
+	configuration := &tenancyv1alpha1.TenancyControllerConfiguration{}
+	if err := mgr.GetAPIReader().Get(ctx, types.NamespacedName{Name: configurationName}, configuration); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+
+	members := make([]MemberCluster, 0, len(configuration.Spec.MemberClusters))
+	for _, spec := range configuration.Spec.MemberClusters {
+		for _, member := range members {
+			if member.Name == spec.Name {
+				return nil, fmt.Errorf("member cluster %s is defined twice", spec.Name)
+			}
+		}
+
+		secret := &corev1.Secret{}
+		if err := mgr.GetAPIReader().Get(ctx, types.NamespacedName{Name: spec.Kubeconfig.Name, Namespace: spec.Kubeconfig.Namespace}, secret); err != nil {
+			return nil, fmt.Errorf("member cluster %s: %w", spec.Name, err)
+		}
+
+		key := spec.Kubeconfig.Key
+		if key == "" {
+			key = "kubeconfig"
+		}
+		restConfig, err := clientcmd.RESTConfigFromKubeConfig(secret.Data[key])
+		if err != nil {
+			return nil, fmt.Errorf("member cluster %s: invalid kubeconfig: %w", spec.Name, err)
+		}
+
+		memberCluster, err := cluster.New(restConfig, func(o *cluster.Options) {
+			o.Scheme = mgr.GetScheme()
+		})
+		if err != nil {
+			return nil, fmt.Errorf("member cluster %s: %w", spec.Name, err)
+		}
+		if err := mgr.Add(memberCluster); err != nil {
+			return nil, err
+		}
+
+		member := MemberCluster{
+			Name:            spec.Name,
+			Cluster:         memberCluster,
+			ProxyEndpoint:   spec.ProxyEndpoint,
+			ProxyServerName: spec.ProxyServerName,
+		}
+		if spec.ProxyCAKey != "" {
+			member.ProxyCA = secret.Data[spec.ProxyCAKey]
+			if len(member.ProxyCA) == 0 {
+				return nil, fmt.Errorf("member cluster %s: secret has no key %s", spec.Name, spec.ProxyCAKey)
+			}
+		}
+
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// tenantCluster is the cluster a tenant is located in, the local cluster has no member
+type tenantCluster struct {
+	client   client.Client
+	recorder record.EventRecorder
+	member   *MemberCluster
+	// Changes are only reported, see shadowClient
+	shadow bool
+}
+
+// Returns the cluster of the given name, tenants of member clusters are enqueued with the cluster name as namespace
+func (i *TenancyController) tenantCluster(name string) *tenantCluster {
+	if name == "" {
+		return &tenantCluster{client: i.Client, recorder: i.Recorder, shadow: i.Shadow}
+	}
+
+	for idx := range i.Clusters {
+		member := &i.Clusters[idx]
+		if member.Name == name {
+			c := &tenantCluster{
+				client:   member.Cluster.GetClient(),
+				recorder: member.Cluster.GetEventRecorderFor("tenancy-controller"),
+				member:   member,
+				shadow:   i.Shadow,
+			}
+			if i.Shadow {
+				c.client = newShadowClient(c.client, i.Log.WithName("shadow").WithValues("cluster", member.Name))
+			}
+
+			return c
+		}
+	}
+
+	return nil
+}
+
+// Returns all clusters, the local cluster first
+func (i *TenancyController) tenantClusters() []*tenantCluster {
+	clusters := []*tenantCluster{i.tenantCluster("")}
+	for _, member := range i.Clusters {
+		clusters = append(clusters, i.tenantCluster(member.Name))
+	}
+
+	return clusters
+}
+
+func (c *tenantCluster) name() string {
+	if c.member == nil {
+		return ""
+	}
+	return c.member.Name
+}
+
+// Name of the Argo CD cluster, its secret and the TenantArgoBinding of the tenant in this cluster. Names of member
+// clusters end with a hash, tenant names allow every character a separator could use and "solar-east" could as well
+// be the name of a local tenant.
+func (c *tenantCluster) argoName(tenant string) string {
+	if c.member == nil {
+		return tenant
+	}
+	sum := sha256.Sum256([]byte(tenant + "/" + c.member.Name))
+	return tenant + "-" + c.member.Name + "-" + hex.EncodeToString(sum[:4])
+}
+
+// Removes the cluster secrets and the TenantArgoBinding of the tenant in the member cluster which were named
+// without the hash. Objects of a local tenant of the same name are left alone.
+func (i *TenancyController) removeLegacyArgoNames(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, ctx context.Context) error {
+	if cluster.member == nil {
+		return nil
+	}
+	name := tenant.Name + "-" + cluster.member.Name
+
+	objects := []client.Object{&tenancyv1alpha1.TenantArgoBinding{ObjectMeta: metav1.ObjectMeta{Name: name}}}
+	for _, instance := range i.argoInstances(ctx) {
+		objects = append(objects, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: instance.Namespace}})
+	}
+
+	for _, object := range objects {
+		if err := i.Client.Get(ctx, client.ObjectKeyFromObject(object), object); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		if object.GetLabels()[utils.TenantLabel] != tenant.Name || object.GetLabels()[utils.ClusterLabel] != cluster.member.Name {
+			continue
+		}
+
+		if err := client.IgnoreNotFound(i.Client.Delete(ctx, object)); err != nil {
+			return err
+		}
+		i.Log.V(3).Info("Legacy Argo CD cluster removed", "name", tenant.Name, "cluster", cluster.member.Name, "object", client.ObjectKeyFromObject(object).String())
+	}
+
+	return nil
+}
+
+func (c *tenantCluster) request(tenant string) reconcile.Request {
+	return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: c.name(), Name: tenant}}
+}
+
+// Labels and annotates the object as artifact of the tenant in this cluster
+func (c *tenantCluster) setTenantMetadata(object metav1.Object, tenant *capsulev1beta2.Tenant) {
+	labels := object.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for key, value := range utils.TenantLabels(tenant) {
+		labels[key] = value
+	}
+	if c.member != nil {
+		labels[utils.ClusterLabel] = c.member.Name
+	}
+	object.SetLabels(labels)
+
+	annotations := object.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[utils.TenantUIDAnnotation] = string(tenant.UID)
+	// Artifacts kept from a deleted tenant of the same name are taken over
+	delete(annotations, utils.RetainedAnnotation)
+	delete(annotations, utils.ArchivedAnnotation)
+	object.SetAnnotations(annotations)
+}
+
+// Returns the URL Argo CD reaches the tenant's capsule-proxy in the cluster at
+func (i *TenancyController) clusterEndpoint(tenant *capsulev1beta2.Tenant, c *tenantCluster, ctx context.Context) string {
+	if c.member != nil {
+		return c.member.ProxyEndpoint
+	}
+
+	_, url := i.getProxyServiceName(tenant, ctx)
+
+	return url
+}
+
+// Returns the tlsClientConfig Argo CD uses to connect to the capsule-proxy of the cluster
+func (i *TenancyController) clusterTLSClientConfig(c *tenantCluster, ctx context.Context) (map[string]interface{}, error) {
+	if c.member == nil {
+		return i.proxyTLSClientConfig(ctx)
+	}
+
+	if len(c.member.ProxyCA) == 0 {
+		return map[string]interface{}{
+			"insecure": true,
+		}, nil
+	}
+
+	config := map[string]interface{}{
+		"caData": base64.StdEncoding.EncodeToString(c.member.ProxyCA),
+	}
+	if c.member.ProxyServerName != "" {
+		config["serverName"] = c.member.ProxyServerName
+	}
+
+	return config, nil
+}
+
+// Returns the tenant merged across all clusters it exists in and the Argo CD clusters it deploys to.
+// Owners and role bindings are merged in cluster order, so every cluster renders the same AppProject.
+func (i *TenancyController) tenantDestinations(name string, ctx context.Context) (*capsulev1beta2.Tenant, []project.Cluster, error) {
+	var merged *capsulev1beta2.Tenant
+	destinations := []project.Cluster{}
+
+	for _, c := range i.tenantClusters() {
+		tenant := &capsulev1beta2.Tenant{}
+		if err := c.client.Get(ctx, types.NamespacedName{Name: name}, tenant); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if !tenant.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		destinations = append(destinations, project.Cluster{
+			Name:       c.argoName(name),
+			Server:     i.clusterEndpoint(tenant, c, ctx),
+			Namespaces: tenant.Status.Namespaces,
+		})
+
+		if merged == nil {
+			merged = tenant.DeepCopy()
+			continue
+		}
+		mergeTenant(merged, tenant)
+	}
+
+	return merged, destinations, nil
+}
+
+// Adds the owners, role bindings and CI token request of the tenant which are missing in merged
+func mergeTenant(merged *capsulev1beta2.Tenant, tenant *capsulev1beta2.Tenant) {
+owners:
+	for _, owner := range tenant.Spec.Owners {
+		for _, existing := range merged.Spec.Owners {
+			if existing.Kind == owner.Kind && existing.Name == owner.Name {
+				continue owners
+			}
+		}
+		merged.Spec.Owners = append(merged.Spec.Owners, owner)
+	}
+
+bindings:
+	for _, binding := range tenant.Spec.AdditionalRoleBindings {
+		for _, existing := range merged.Spec.AdditionalRoleBindings {
+			if reflect.DeepEqual(existing, binding) {
+				continue bindings
+			}
+		}
+		merged.Spec.AdditionalRoleBindings = append(merged.Spec.AdditionalRoleBindings, binding)
+	}
+
+	// The project gains the CI role when the tenant requests a CI token in any cluster
+	if namespace, found := tenant.Annotations[overrides.CITokenNamespaceAnnotation]; found {
+		if _, exists := merged.Annotations[overrides.CITokenNamespaceAnnotation]; !exists {
+			if merged.Annotations == nil {
+				merged.Annotations = map[string]string{}
+			}
+			merged.Annotations[overrides.CITokenNamespaceAnnotation] = namespace
+		}
+	}
+}
+
+// Enqueues the tenant in every cluster, used when a cluster drops out of the tenant's project
+func (i *TenancyController) enqueueTenantClusters(_ context.Context, object client.Object) []reconcile.Request {
+	clusters := i.tenantClusters()
+
+	requests := make([]reconcile.Request, 0, len(clusters))
+	for _, c := range clusters {
+		requests = append(requests, c.request(object.GetName()))
+	}
+
+	return requests
+}
+
+// Returns a handler enqueuing the tenants of the member cluster
+func (i *TenancyController) enqueueMemberTenant(member string) func(context.Context, client.Object) []reconcile.Request {
+	return func(_ context.Context, object client.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: member, Name: object.GetName()}}}
+	}
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ reconcile.Reconciler = &ConfigurationController{}
+
+// ConfigurationController hot reloads the TenancyControllerConfiguration into the TenancyController
+type ConfigurationController struct {
+	Client  client.Client
+	Log     logr.Logger
+	Name    string
+	Tenancy *TenancyController
+}
+
+func (c *ConfigurationController) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
+	// Load the configuration before the first tenant is reconciled, the cache is not started yet
+	if err := c.load(ctx, mgr.GetAPIReader()); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&tenancyv1alpha1.TenancyControllerConfiguration{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			return object.GetName() == c.Name
+		}))).
+		Complete(c)
+}
+
+func (c *ConfigurationController) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	if err := c.load(ctx, c.Client); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (c *ConfigurationController) load(ctx context.Context, reader client.Reader) error {
+	configuration := &tenancyv1alpha1.TenancyControllerConfiguration{}
+	if err := reader.Get(ctx, types.NamespacedName{Name: c.Name}, configuration); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		c.Log.V(3).Info("Configuration not found, using defaults", "name", c.Name)
+
+		return c.Tenancy.configure(ctx, nil)
+	}
+
+	// An invalid configuration is reported instead of stopping the controller, which keeps the previous configuration
+	// or, when starting, the flags
+	if err := c.Tenancy.configure(ctx, &configuration.Spec); err != nil {
+		c.Log.Error(err, "Invalid configuration, keeping the previous one", "name", c.Name)
+		if c.Tenancy.Recorder != nil {
+			c.Tenancy.Recorder.Event(configuration, corev1.EventTypeWarning, "InvalidConfiguration", err.Error())
+		}
+		if c.Tenancy.current.Load() == nil {
+			return c.Tenancy.configure(ctx, nil)
+		}
+		return nil
+	}
+
+	c.Log.V(3).Info("Configuration loaded", "name", c.Name)
+
+	return nil
+}
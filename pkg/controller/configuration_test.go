@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestInvalidConfiguration(t *testing.T) {
+
+	configuration := &tenancyv1alpha1.TenancyControllerConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec:       tenancyv1alpha1.TenancyControllerConfigurationSpec{TokenTTL: &metav1.Duration{Duration: time.Minute}},
+	}
+	c := newFakeClient(t, configuration)
+
+	recorder := record.NewFakeRecorder(10)
+	controller := &ConfigurationController{
+		Client: c,
+		Log:    logr.Discard(),
+		Name:   "default",
+		Tenancy: &TenancyController{
+			Log:      logr.Discard(),
+			Recorder: recorder,
+			Options:  TenancyControllerOptions{ArgoCDNamespace: "argocd", TokenTTL: time.Hour},
+			reload:   make(chan event.GenericEvent, 3),
+		},
+	}
+	ctx := context.Background()
+
+	// The controller starts with the flags
+	if err := controller.load(ctx, c); err != nil {
+		t.Fatalf("invalid configuration stopped the controller: %v", err)
+	}
+	if ttl := controller.Tenancy.options(ctx).TokenTTL; ttl != time.Hour {
+		t.Fatalf("token ttl = %s, want the flag", ttl)
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("%d events recorded, want 1", len(recorder.Events))
+	}
+
+	// A valid configuration is kept when it is replaced by an invalid one
+	configuration.Spec.TokenTTL.Duration = 2 * time.Hour
+	if err := c.Update(ctx, configuration); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.load(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	configuration.Spec.TokenTTL.Duration = time.Minute
+	if err := c.Update(ctx, configuration); err != nil {
+		t.Fatal(err)
+	}
+	if err := controller.load(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := controller.Tenancy.options(ctx).TokenTTL; ttl != 2*time.Hour {
+		t.Fatalf("token ttl = %s, want the previous configuration", ttl)
+	}
+}
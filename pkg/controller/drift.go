@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Remembers the desired state applied to the object with the given key. An object which had to be changed
+// although the desired state is the same as last time was modified outside of the controller.
+func (i *TenancyController) observeDrift(step string, key string, desired interface{}, result controllerutil.OperationResult) {
+	// Nothing is applied in shadow mode
+	if i.Shadow {
+		return
+	}
+
+	data, err := json.Marshal(desired)
+	if err != nil {
+		return
+	}
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+
+	previous, found := i.applied.Swap(step+"/"+key, digest)
+	if !found || previous.(string) != digest || result == controllerutil.OperationResultNone {
+		return
+	}
+
+	i.Log.V(3).Info("Drift reverted", "step", step, "object", key)
+	metrics.DriftCorrections.WithLabelValues(step).Inc()
+}
+
+// Forgets the desired state of a removed object, so recreating it is not taken for drift
+func (i *TenancyController) forgetDrift(step string, key string) {
+	i.applied.Delete(step + "/" + key)
+}
+
+// Returns the Argo CD instance installed in the namespace
+func (i *TenancyController) namespaceInstance(namespace string, ctx context.Context) *tenancyv1alpha1.ArgoCDInstanceSpec {
+	for _, instance := range i.argoInstances(ctx) {
+		if instance.Namespace == namespace {
+			return &instance
+		}
+	}
+	return nil
+}
+
+// Enqueues the tenant of a managed AppProject
+func (i *TenancyController) enqueueOnAppProject(ctx context.Context, object client.Object) []reconcile.Request {
+	if i.namespaceInstance(object.GetNamespace(), ctx) == nil {
+		return nil
+	}
+	if !labels.SelectorFromSet(utils.CommonLabels()).Matches(labels.Set(object.GetLabels())) {
+		return nil
+	}
+
+	return i.enqueueTenantClusters(ctx, object)
+}
+
+// Enqueues the tenant of an Argo CD cluster secret by its tenant and cluster labels
+func (i *TenancyController) enqueueOnClusterSecret(ctx context.Context, object client.Object) []reconcile.Request {
+	if i.namespaceInstance(object.GetNamespace(), ctx) == nil {
+		return nil
+	}
+	if object.GetLabels()["argocd.argoproj.io/secret-type"] != "cluster" {
+		return nil
+	}
+
+	// Secrets of member cluster tenants carry the cluster label, names are not unique without it
+	tenant := object.GetLabels()[utils.TenantLabel]
+	if tenant == "" {
+		return []reconcile.Request{i.tenantCluster("").request(object.GetName())}
+	}
+	cluster := i.tenantCluster(object.GetLabels()[utils.ClusterLabel])
+	if cluster == nil {
+		return nil
+	}
+
+	return []reconcile.Request{cluster.request(tenant)}
+}
+
+// Returns a handler enqueueing the tenants whose policy csv changed in the RBAC ConfigMap of an Argo CD instance
+func (i *TenancyController) rbacConfigMapHandler() handler.EventHandler {
+	isRBACConfigMap := func(object client.Object, ctx context.Context) bool {
+		instance := i.namespaceInstance(object.GetNamespace(), ctx)
+		return instance != nil && object.GetName() == rbacConfigMapName(*instance)
+	}
+
+	enqueue := func(tenant string, q workqueue.RateLimitingInterface) {
+		for _, cluster := range i.tenantClusters() {
+			q.Add(cluster.request(tenant))
+		}
+	}
+
+	return handler.Funcs{
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			oldConfigMap, okOld := e.ObjectOld.(*corev1.ConfigMap)
+			newConfigMap, okNew := e.ObjectNew.(*corev1.ConfigMap)
+			if !okOld || !okNew || !isRBACConfigMap(newConfigMap, ctx) {
+				return
+			}
+
+			keys := map[string]struct{}{}
+			for key := range oldConfigMap.Data {
+				keys[key] = struct{}{}
+			}
+			for key := range newConfigMap.Data {
+				keys[key] = struct{}{}
+			}
+
+			for key := range keys {
+				tenant, found := strings.CutPrefix(key, "policy.")
+				if !found || !strings.HasSuffix(tenant, ".csv") {
+					continue
+				}
+				if oldConfigMap.Data[key] != newConfigMap.Data[key] {
+					enqueue(strings.TrimSuffix(tenant, ".csv"), q)
+				}
+			}
+		},
+		DeleteFunc: func(ctx context.Context, e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+			if !isRBACConfigMap(e.Object, ctx) {
+				return
+			}
+
+			for _, request := range i.enqueueAllTenants(ctx, e.Object) {
+				q.Add(request)
+			}
+		},
+	}
+}
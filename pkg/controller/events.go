@@ -0,0 +1,68 @@
+package controller
+
+import (
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Provisioning steps, the Event reasons are composed of the step and its outcome
+const (
+	StepServiceAccount = "ServiceAccount"
+	StepToken          = "Token"
+	StepProxyService   = "ProxyService"
+	StepClusterSecret  = "ClusterSecret"
+	StepAppProject     = "AppProject"
+	StepRBACPolicy     = "RBACPolicy"
+	StepAppsNamespace  = "AppsNamespace"
+	StepCIToken        = "CIToken"
+)
+
+// Records an Event on the tenant in its cluster for a provisioning step. Unchanged objects are not reported.
+func (c *tenantCluster) recordStep(tenant *capsulev1beta2.Tenant, step string, object client.Object, result controllerutil.OperationResult, err error) {
+	name := object.GetName()
+	if object.GetNamespace() != "" {
+		name = object.GetNamespace() + "/" + name
+	}
+
+	if err != nil {
+		c.recorder.Eventf(tenant, corev1.EventTypeWarning, step+"Failed", "%s %s failed: %s", step, name, err)
+		return
+	}
+
+	// Nothing was applied, the changes are reported by recordShadow
+	if c.shadow {
+		return
+	}
+
+	switch result {
+	case controllerutil.OperationResultCreated:
+		c.recorder.Eventf(tenant, corev1.EventTypeNormal, step+"Created", "%s %s created", step, name)
+	case controllerutil.OperationResultUpdated:
+		c.recorder.Eventf(tenant, corev1.EventTypeNormal, step+"Updated", "%s %s updated", step, name)
+	}
+}
+
+// Records an Event on the tenant for a teardown step, the reason is composed of the step and the applied deletion policy
+func (c *tenantCluster) recordTeardown(tenant *capsulev1beta2.Tenant, step string, object client.Object, policy string, err error) {
+	name := object.GetName()
+	if object.GetNamespace() != "" {
+		name = object.GetNamespace() + "/" + name
+	}
+
+	if err != nil {
+		c.recorder.Eventf(tenant, corev1.EventTypeWarning, step+"Failed", "%s %s teardown failed: %s", step, name, err)
+		return
+	}
+
+	switch policy {
+	case tenancyv1alpha1.DeletionPolicyRetain:
+		c.recorder.Eventf(tenant, corev1.EventTypeNormal, step+"Retained", "%s %s retained", step, name)
+	case tenancyv1alpha1.DeletionPolicyArchive:
+		c.recorder.Eventf(tenant, corev1.EventTypeNormal, step+"Archived", "%s %s archived", step, name)
+	default:
+		c.recorder.Eventf(tenant, corev1.EventTypeNormal, step+"Deleted", "%s %s deleted", step, name)
+	}
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/roles"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ArgoEnforcer loads the live RBAC ConfigMap and the project roles of the AppProjects of an Argo CD instance
+// (the only configured instance when empty) and returns an enforcer evaluating them like the instance does.
+func ArgoEnforcer(ctx context.Context, c client.Client, options TenancyControllerOptions, configurationName string, instanceName string, log logr.Logger) (*roles.Enforcer, error) {
+	tenancy := &TenancyController{
+		Client:  c,
+		Log:     log,
+		Options: options,
+	}
+
+	configuration := &tenancyv1alpha1.TenancyControllerConfiguration{}
+	if err := c.Get(ctx, types.NamespacedName{Name: configurationName}, configuration); err != nil {
+		if client.IgnoreNotFound(err) != nil {
+			return nil, err
+		}
+	} else if err := tenancy.configure(ctx, &configuration.Spec); err != nil {
+		return nil, err
+	}
+
+	instances := tenancy.argoInstances(ctx)
+	var instance *tenancyv1alpha1.ArgoCDInstanceSpec
+	for idx := range instances {
+		if instances[idx].Name == instanceName || (instanceName == "" && len(instances) == 1) {
+			instance = &instances[idx]
+		}
+	}
+	if instance == nil {
+		names := make([]string, 0, len(instances))
+		for _, instance := range instances {
+			names = append(names, instance.Name)
+		}
+		if instanceName == "" {
+			return nil, fmt.Errorf("select one of the argo instances %s", strings.Join(names, ", "))
+		}
+		return nil, fmt.Errorf("unknown argo instance %q, expected one of %s", instanceName, strings.Join(names, ", "))
+	}
+
+	builtin, err := roles.ParsePolicyCSV(roles.ArgoBuiltinPolicy)
+	if err != nil {
+		return nil, err
+	}
+	sources := []roles.PolicySource{{Name: "builtin", Lines: builtin}}
+
+	configmap := &corev1.ConfigMap{}
+	if err := c.Get(ctx, client.ObjectKey{Name: rbacConfigMapName(*instance), Namespace: instance.Namespace}, configmap); err != nil {
+		return nil, err
+	}
+
+	// Argo CD merges policy.csv and every policy.<name>.csv key
+	keys := make([]string, 0, len(configmap.Data))
+	for key := range configmap.Data {
+		if strings.HasPrefix(key, "policy.") && strings.HasSuffix(key, ".csv") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		lines, err := roles.ParsePolicyCSV(configmap.Data[key])
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s %s: %w", configmap.Namespace, configmap.Name, key, err)
+		}
+		sources = append(sources, roles.PolicySource{Name: configmap.Name + " " + key, Lines: lines})
+	}
+
+	projects := &unstructured.UnstructuredList{}
+	projects.SetAPIVersion("argoproj.io/v1alpha1")
+	projects.SetKind("AppProjectList")
+	if err := c.List(ctx, projects, client.InNamespace(instance.Namespace)); err != nil {
+		return nil, err
+	}
+	for _, appProject := range projects.Items {
+		lines, err := projectPolicies(&appProject)
+		if err != nil {
+			return nil, fmt.Errorf("AppProject %s: %w", appProject.GetName(), err)
+		}
+		sources = append(sources, roles.PolicySource{Name: "AppProject " + appProject.GetName(), Lines: lines})
+	}
+
+	return roles.NewEnforcer(sources, configmap.Data["policy.default"], configmap.Data["policy.matchMode"])
+}
+
+// Returns the policies of the project roles and assigns the role's groups to them, as Argo CD does
+func projectPolicies(appProject *unstructured.Unstructured) (roles.PolicyCSV, error) {
+	projectRoles, _, err := unstructured.NestedSlice(appProject.Object, "spec", "roles")
+	if err != nil {
+		return nil, err
+	}
+
+	lines := roles.PolicyCSV{}
+	for _, projectRole := range projectRoles {
+		role, ok := projectRole.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(role, "name")
+		policies, _, _ := unstructured.NestedStringSlice(role, "policies")
+		groups, _, _ := unstructured.NestedStringSlice(role, "groups")
+
+		parsed, err := roles.ParsePolicyCSV(strings.Join(policies, "\n"))
+		if err != nil {
+			return nil, fmt.Errorf("role %s: %w", name, err)
+		}
+		lines = append(lines, parsed...)
+
+		for _, group := range groups {
+			lines = append(lines, roles.PolicyLine{Grouping: &roles.Grouping{Subject: group, Role: "proj:" + appProject.GetName() + ":" + name}})
+		}
+	}
+
+	return lines, nil
+}
@@ -2,37 +2,267 @@ package controller
 
 import (
 	"context"
+	"strings"
+	"time"
 
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/overrides"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/roles"
 	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/pkg/metrics"
 	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
 const ControllerFinalizer = "kubernetes.gelan.cloud/tenancy-controller"
 
-func (i *TenancyController) finalize(tenant *capsulev1beta2.Tenant, ctx context.Context) error {
-	return i.finalizeArgo(tenant, ctx)
+// Tears down the artifacts of the tenant according to its deletion policy, each step is reported as Event.
+// Returns a non zero result while Argo CD Applications of the tenant keep the teardown waiting.
+func (i *TenancyController) finalize(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, ctx context.Context) (ctrl.Result, error) {
+	policy := i.tenantDeletionPolicy(tenant, ctx)
+	i.Log.V(3).Info("Tearing down tenant", "name", tenant.Name, "cluster", cluster.name(), "policy", policy)
+
+	// The tenant still exists in other clusters, its project stays in place
+	merged, _, err := i.tenantDestinations(tenant.Name, ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Retained and archived clusters stay reachable for their Applications
+	if policy == tenancyv1alpha1.DeletionPolicyDelete {
+		result, err := i.finalizeApplications(tenant, cluster, merged == nil, ctx)
+		if err != nil || !result.IsZero() {
+			return result, err
+		}
+	}
+
+	if err := i.finalizeCITokens(tenant, cluster, ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if cluster.member == nil {
+		if err := i.finalizeAppsNamespace(tenant, cluster, policy, ctx); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	account := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tenant.Name,
+			Namespace: i.serviceAccountNamespace(tenant, ctx),
+		},
+	}
+	if err := i.teardown(tenant, cluster, cluster.client, StepServiceAccount, account, policy, ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if cluster.member == nil {
+		svc, _ := i.getProxyServiceName(tenant, ctx)
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      svc,
+				Namespace: i.options(ctx).CapsuleProxyServiceNamespace,
+			},
+		}
+		if err := i.teardown(tenant, cluster, i.Client, StepProxyService, service, policy, ctx); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// The routing of the tenant may have changed, tear it down in every instance
+	for _, instance := range i.argoInstances(ctx) {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      cluster.argoName(tenant.Name),
+				Namespace: instance.Namespace,
+			},
+		}
+		i.forgetDrift(metrics.StepClusterSecret, client.ObjectKeyFromObject(secret).String())
+		if err := i.teardown(tenant, cluster, i.Client, StepClusterSecret, secret, policy, ctx); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	metrics.TokenExpiration.DeleteLabelValues(cluster.argoName(tenant.Name))
+	forgetShadow(cluster.argoName(tenant.Name))
+
+	// The binding only reports the provisioning and is removed with every policy
+	binding := &tenancyv1alpha1.TenantArgoBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: cluster.argoName(tenant.Name),
+		},
+	}
+	if err := i.Client.Delete(ctx, binding); client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Reconcile the other clusters of the tenant to drop this cluster from the project
+	if merged != nil {
+		i.enqueue <- event.GenericEvent{Object: tenant}
+		return ctrl.Result{}, nil
+	}
+
+	return ctrl.Result{}, i.finalizeArgo(tenant, cluster, policy, ctx)
 }
 
-func (i *TenancyController) finalizeArgo(tenant *capsulev1beta2.Tenant, ctx context.Context) error {
+// Applies the deletion policy to the apps namespace of the tenant. It is owned by the tenant, the garbage collector
+// would delete it with the tenant regardless of the policy.
+func (i *TenancyController) finalizeAppsNamespace(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, policy string, ctx context.Context) error {
+	namespace := &corev1.Namespace{}
+	if err := cluster.client.Get(ctx, client.ObjectKey{Name: appsNamespaceName(tenant.Name)}, namespace); err != nil {
+		return client.IgnoreNotFound(err)
+	}
 
-	// Update existing configmap with new csv
-	configmap := &corev1.ConfigMap{}
-	err := i.Client.Get(ctx, client.ObjectKey{Name: "argocd-rbac-cm", Namespace: i.Options.ArgoCDNamespace}, configmap)
-	if err != nil {
+	// Namespaces which were not created by the controller are left to the garbage collector
+	if namespace.Labels[utils.TenantLabel] != tenant.Name {
+		return nil
+	}
+
+	return i.teardown(tenant, cluster, cluster.client, StepAppsNamespace, namespace, policy, ctx)
+}
+
+// Tears down the AppProject and policy csv shared by all clusters of the tenant
+func (i *TenancyController) finalizeArgo(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, policy string, ctx context.Context) error {
+	for _, instance := range i.argoInstances(ctx) {
+		appProject := &unstructured.Unstructured{}
+		appProject.SetAPIVersion("argoproj.io/v1alpha1")
+		appProject.SetKind("AppProject")
+		appProject.SetName(tenant.Name)
+		appProject.SetNamespace(instance.Namespace)
+		i.forgetDrift(metrics.StepAppProject, client.ObjectKeyFromObject(appProject).String())
+		if err := i.teardown(tenant, cluster, i.Client, StepAppProject, appProject, policy, ctx); err != nil {
+			return err
+		}
+		i.changedProjects()
+
+		if err := i.teardownArgoPolicy(tenant, cluster, instance, policy, ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the deletion policy of the tenant, which may be overridden with an annotation
+func (i *TenancyController) tenantDeletionPolicy(tenant *capsulev1beta2.Tenant, ctx context.Context) string {
+	// Invalid overrides have already been reported while provisioning
+	tenantOverrides, _ := overrides.Parse(tenant, i.options(ctx).AllowedOverrides)
+	if tenantOverrides.DeletionPolicy != "" {
+		return tenantOverrides.DeletionPolicy
+	}
+
+	if i.options(ctx).DeletionPolicy != "" {
+		return i.options(ctx).DeletionPolicy
+	}
+
+	return tenancyv1alpha1.DeletionPolicyDelete
+}
+
+// Applies the deletion policy to an artifact of the tenant
+func (i *TenancyController) teardown(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, c client.Client, step string, object client.Object, policy string, ctx context.Context) error {
+	if err := c.Get(ctx, client.ObjectKeyFromObject(object), object); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		cluster.recordTeardown(tenant, step, object, policy, err)
 		return err
 	}
 
-	_, err = controllerutil.CreateOrUpdate(ctx, i.Client, configmap, func() error {
-		delete(configmap.Data, utils.ArgoPolicyName(tenant))
+	var err error
+	switch policy {
+	case tenancyv1alpha1.DeletionPolicyRetain, tenancyv1alpha1.DeletionPolicyArchive:
+		err = retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+			if err := c.Get(ctx, client.ObjectKeyFromObject(object), object); err != nil {
+				return err
+			}
+			keepObject(object, tenant, policy)
+
+			return c.Update(ctx, object)
+		})
+	default:
+		err = client.IgnoreNotFound(c.Delete(ctx, object))
+	}
+	cluster.recordTeardown(tenant, step, object, policy, err)
+
+	return err
+}
+
+// Removes the owner references of the tenant, so the object survives it, and marks it as retained or archived
+func keepObject(object client.Object, tenant *capsulev1beta2.Tenant, policy string) {
+	references := []metav1.OwnerReference{}
+	for _, reference := range object.GetOwnerReferences() {
+		if reference.UID != tenant.UID {
+			references = append(references, reference)
+		}
+	}
+	object.SetOwnerReferences(references)
+
+	key := utils.RetainedAnnotation
+	if policy == tenancyv1alpha1.DeletionPolicyArchive {
+		key = utils.ArchivedAnnotation
+	}
 
+	annotations := object.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if _, exists := annotations[key]; !exists {
+		annotations[key] = time.Now().UTC().Format(time.RFC3339)
+	}
+	object.SetAnnotations(annotations)
+}
+
+// Applies the deletion policy to the tenant's policy csv in the RBAC ConfigMap of the instance
+func (i *TenancyController) teardownArgoPolicy(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, instance tenancyv1alpha1.ArgoCDInstanceSpec, policy string, ctx context.Context) error {
+	configmap := &corev1.ConfigMap{}
+	key := client.ObjectKey{Name: rbacConfigMapName(instance), Namespace: instance.Namespace}
+	i.forgetDrift(metrics.StepRBACConfigMap, key.String()+"/"+utils.ArgoPolicyName(tenant))
+	if err := i.Client.Get(ctx, key, configmap); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if _, exists := configmap.Data[utils.ArgoPolicyName(tenant)]; !exists {
 		return nil
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		if err := i.Client.Get(ctx, key, configmap); err != nil {
+			return err
+		}
+
+		switch policy {
+		case tenancyv1alpha1.DeletionPolicyRetain:
+			configmap.Data[utils.ArgoPolicyName(tenant)] = markPolicy(configmap.Data[utils.ArgoPolicyName(tenant)], roles.ArgoCSVRetainedMarker)
+		case tenancyv1alpha1.DeletionPolicyArchive:
+			configmap.Data[utils.ArgoPolicyName(tenant)] = markPolicy(configmap.Data[utils.ArgoPolicyName(tenant)], roles.ArgoCSVArchivedMarker)
+		default:
+			delete(configmap.Data, utils.ArgoPolicyName(tenant))
+		}
+
+		return i.Client.Update(ctx, configmap)
 	})
+	cluster.recordTeardown(tenant, StepRBACPolicy, configmap, policy, err)
 	if err != nil {
 		return err
 	}
 
+	metrics.RBACConfigMapSize.WithLabelValues(instance.Name).Set(float64(configMapSize(configmap)))
+
 	return nil
 }
+
+// Adds the marker with the current time below the header of the policy csv
+func markPolicy(csv string, marker string) string {
+	if strings.Contains(csv, marker) {
+		return csv
+	}
+
+	header, rest, _ := strings.Cut(csv, "\n")
+
+	return header + "\n" + marker + time.Now().UTC().Format(time.RFC3339) + "\n" + rest
+}
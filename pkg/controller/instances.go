@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/pkg/metrics"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Returns the configured Argo CD instances, by default the instance installed in the ArgoCDNamespace
+func (i *TenancyController) argoInstances(ctx context.Context) []tenancyv1alpha1.ArgoCDInstanceSpec {
+	options := i.options(ctx)
+	if len(options.ArgoCDInstances) > 0 {
+		return options.ArgoCDInstances
+	}
+
+	return []tenancyv1alpha1.ArgoCDInstanceSpec{
+		{
+			Name:      "default",
+			Namespace: options.ArgoCDNamespace,
+			API:       options.ArgoCDAPI,
+		},
+	}
+}
+
+// Returns the Argo CD instances the tenant is routed to
+func (i *TenancyController) tenantInstances(tenant *capsulev1beta2.Tenant, ctx context.Context) ([]tenancyv1alpha1.ArgoCDInstanceSpec, error) {
+	instances := []tenancyv1alpha1.ArgoCDInstanceSpec{}
+	for _, instance := range i.argoInstances(ctx) {
+		if instance.TenantSelector == nil {
+			instances = append(instances, instance)
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(instance.TenantSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tenant selector in argo instance %s: %w", instance.Name, err)
+		}
+
+		if selector.Matches(labels.Set(tenant.Labels)) {
+			instances = append(instances, instance)
+		}
+	}
+
+	return instances, nil
+}
+
+func containsInstance(instances []tenancyv1alpha1.ArgoCDInstanceSpec, name string) bool {
+	for _, instance := range instances {
+		if instance.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func rbacConfigMapName(instance tenancyv1alpha1.ArgoCDInstanceSpec) string {
+	if instance.RBACConfigMap != "" {
+		return instance.RBACConfigMap
+	}
+	return "argocd-rbac-cm"
+}
+
+func cmdParamsConfigMapName(instance tenancyv1alpha1.ArgoCDInstanceSpec) string {
+	if instance.CmdParamsConfigMap != "" {
+		return instance.CmdParamsConfigMap
+	}
+	return "argocd-cmd-params-cm"
+}
+
+// Removes the cluster secret of the tenant in its cluster from the Argo CD instance
+func (i *TenancyController) removeArgoCluster(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, instance tenancyv1alpha1.ArgoCDInstanceSpec, ctx context.Context) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.argoName(tenant.Name),
+			Namespace: instance.Namespace,
+		},
+	}
+
+	i.forgetDrift(metrics.StepClusterSecret, client.ObjectKeyFromObject(secret).String())
+
+	return client.IgnoreNotFound(i.Client.Delete(ctx, secret))
+}
+
+// Removes the AppProject and the policy csv of the tenant from the Argo CD instance
+func (i *TenancyController) removeArgoProject(tenant *capsulev1beta2.Tenant, instance tenancyv1alpha1.ArgoCDInstanceSpec, ctx context.Context) error {
+	appProject := &unstructured.Unstructured{}
+	appProject.SetAPIVersion("argoproj.io/v1alpha1")
+	appProject.SetKind("AppProject")
+	appProject.SetName(tenant.Name)
+	appProject.SetNamespace(instance.Namespace)
+	i.forgetDrift(metrics.StepAppProject, client.ObjectKeyFromObject(appProject).String())
+	if err := i.Client.Delete(ctx, appProject); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	i.changedProjects()
+
+	configmap := &corev1.ConfigMap{}
+	configmapKey := client.ObjectKey{Name: rbacConfigMapName(instance), Namespace: instance.Namespace}
+	i.forgetDrift(metrics.StepRBACConfigMap, configmapKey.String()+"/"+utils.ArgoPolicyName(tenant))
+	err := i.Client.Get(ctx, configmapKey, configmap)
+	if err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if _, exists := configmap.Data[utils.ArgoPolicyName(tenant)]; !exists {
+		return nil
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		if err := i.Client.Get(ctx, client.ObjectKeyFromObject(configmap), configmap); err != nil {
+			return err
+		}
+		delete(configmap.Data, utils.ArgoPolicyName(tenant))
+
+		return i.Client.Update(ctx, configmap)
+	})
+	if err != nil {
+		return err
+	}
+
+	metrics.RBACConfigMapSize.WithLabelValues(instance.Name).Set(float64(configMapSize(configmap)))
+
+	return nil
+}
@@ -3,16 +3,30 @@ package controller
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/argocd"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/project"
 	"github.com/go-logr/logr"
 	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // IngressController should implement the Reconciler interface
@@ -22,7 +36,22 @@ type TenancyController struct {
 	Client   client.Client
 	Log      logr.Logger
 	Recorder record.EventRecorder
-	Options  TenancyControllerOptions
+	// Defaults, which may be overwritten by the TenancyControllerConfiguration
+	Options TenancyControllerOptions
+	// Member clusters whose tenants are registered in addition to the local ones
+	Clusters []MemberCluster
+	// Only report the changes the reconciliation would apply, without mutating any cluster
+	Shadow bool
+
+	current atomic.Pointer[TenancyControllerOptions]
+	reload  chan event.GenericEvent
+	enqueue chan event.GenericEvent
+	// Signals the ApplicationNamespaces that AppProjects changed, nil when they are not maintained
+	projectsChanged chan struct{}
+	// Digest of the desired state last applied to each provisioned object
+	applied sync.Map
+	// Returns the client of the Argo CD API of an instance, replaced when rendering offline
+	argoClient func(instance tenancyv1alpha1.ArgoCDInstanceSpec, ctx context.Context) (argocd.Client, error)
 }
 
 type TenancyControllerOptions struct {
@@ -32,18 +61,64 @@ type TenancyControllerOptions struct {
 	SystemTenantNamespace        string
 	UserTenantNamespace          string
 	ArgoCDNamespace              string
+	ArgoCDInstances              []tenancyv1alpha1.ArgoCDInstanceSpec
+	Roles                        []tenancyv1alpha1.ArgoProjectRoleSpec
+	ProjectTemplate              string
+	AllowedOverrides             []string
+	TokenTTL                     time.Duration
+	CapsuleProxyServerName       string
+	CapsuleProxyCA               *tenancyv1alpha1.CapsuleProxyCASpec
+	DeletionPolicy               string
+	ArchiveRetention             time.Duration
+	ApplicationDeletionPolicy    string
+	AppsNamespace                bool
+	ArgoCDAPI                    *tenancyv1alpha1.ArgoCDAPISpec
+	CIRole                       *tenancyv1alpha1.ArgoProjectRoleSpec
+	CITokenTTL                   time.Duration
 }
 
 func (i *TenancyController) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	i.reload = make(chan event.GenericEvent)
+	i.enqueue = make(chan event.GenericEvent)
+
+	if i.Shadow {
+		i.Client = newShadowClient(i.Client, i.Log.WithName("shadow"))
+	}
+
+	// AppProjects are watched unstructured, the Argo CD types are not part of the scheme
+	appProject := &unstructured.Unstructured{}
+	appProject.SetAPIVersion("argoproj.io/v1alpha1")
+	appProject.SetKind("AppProject")
+
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&capsulev1beta2.Tenant{}).
 		Owns(&corev1.ServiceAccount{}).
 		Owns(&corev1.Secret{}).
 		Owns(&corev1.Service{}).
-		Complete(i)
+		Watches(&tenancyv1alpha1.ArgoTenantPolicy{}, handler.EnqueueRequestsFromMapFunc(i.enqueueAllTenants)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(i.enqueueOnProxyCA)).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(i.enqueueOnProxyCA)).
+		Watches(&corev1.ConfigMap{}, i.rbacConfigMapHandler()).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(i.enqueueOnClusterSecret)).
+		Watches(appProject, handler.EnqueueRequestsFromMapFunc(i.enqueueOnAppProject)).
+		WatchesRawSource(&source.Channel{Source: i.reload}, handler.EnqueueRequestsFromMapFunc(i.enqueueAllTenants)).
+		WatchesRawSource(&source.Channel{Source: i.enqueue}, handler.EnqueueRequestsFromMapFunc(i.enqueueTenantClusters))
+
+	// Tenants of member clusters are enqueued with the cluster name as namespace
+	for _, member := range i.Clusters {
+		builder = builder.WatchesRawSource(source.Kind(member.Cluster.GetCache(), &capsulev1beta2.Tenant{}), handler.EnqueueRequestsFromMapFunc(i.enqueueMemberTenant(member.Name)))
+	}
+
+	// The tenants are counted periodically, not on every reconciliation
+	if err := mgr.Add(manager.RunnableFunc(i.countTenants)); err != nil {
+		return err
+	}
+
+	return builder.Complete(i)
 }
 
 func (i *TenancyController) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	ctx = i.withOptions(ctx)
 	log := i.Log.WithValues("tenant", request.NamespacedName)
 	//reconcileStart := time.Now()
 	//reconciliationLoopID := uuid.New().String()
@@ -52,23 +127,46 @@ func (i *TenancyController) Reconcile(ctx context.Context, request ctrl.Request)
 		"tenant", request.Name,
 	)
 
+	cluster := i.tenantCluster(request.Namespace)
+	if cluster == nil {
+		log.V(1).Info("Unknown member cluster", "cluster", request.Namespace)
+		return ctrl.Result{}, nil
+	}
+
 	log.V(3).Info("Fetch Tenant Resource")
 	origin := &capsulev1beta2.Tenant{}
-	if err := i.Client.Get(ctx, request.NamespacedName, origin); err != nil {
+	if err := cluster.client.Get(ctx, types.NamespacedName{Name: request.Name}, origin); err != nil {
 		log.V(1).Error(err, "Unable to fetch tenant")
+		if apierrors.IsNotFound(err) {
+			forgetShadow(cluster.argoName(request.Name))
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	// Shadow mode neither provisions nor tears down tenants
+	if i.Shadow {
+		if !origin.ObjectMeta.DeletionTimestamp.IsZero() {
+			forgetShadow(cluster.argoName(origin.Name))
+			return ctrl.Result{}, nil
+		}
+		return i.reconcileShadow(origin, cluster, ctx)
+	}
+	forgetShadow(cluster.argoName(origin.Name))
+
 	// Finalize Dependencies
 	if !origin.ObjectMeta.DeletionTimestamp.IsZero() {
 		if controllerutil.ContainsFinalizer(origin, ControllerFinalizer) {
-			err := i.finalize(origin, ctx)
+			result, err := i.finalize(origin, cluster, ctx)
 			if err != nil {
 				return ctrl.Result{}, fmt.Errorf("Finalize tenant %s", err)
 			}
+			// The teardown waits for the Applications of the tenant
+			if !result.IsZero() {
+				return result, nil
+			}
 			controllerutil.RemoveFinalizer(origin, ControllerFinalizer)
 			err = retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
-				if err := i.Client.Update(ctx, origin); err != nil {
+				if err := cluster.client.Update(ctx, origin); err != nil {
 					return err
 				}
 
@@ -84,10 +182,14 @@ func (i *TenancyController) Reconcile(ctx context.Context, request ctrl.Request)
 
 	i.Log.V(3).Info("Addons reconcile", "triggered-by", request.NamespacedName)
 
-	err := i.reconcileAddons(origin, ctx)
+	status := &tenancyv1alpha1.TenantArgoBindingStatus{}
+	err := i.reconcileAddons(origin, cluster, status, ctx)
+	if bindingErr := i.tenantArgoBinding(origin, cluster, status, err, ctx); bindingErr != nil {
+		log.V(1).Error(bindingErr, "binding status error")
+	}
 	if err != nil {
 		log.V(1).Error(err, "addons error")
-		return ctrl.Result{}, nil
+		return ctrl.Result{}, err
 	}
 
 	i.Log.V(3).Info("Addons reconciled", "triggered-by", request.NamespacedName)
@@ -95,7 +197,7 @@ func (i *TenancyController) Reconcile(ctx context.Context, request ctrl.Request)
 	if !controllerutil.ContainsFinalizer(origin, ControllerFinalizer) {
 		controllerutil.AddFinalizer(origin, ControllerFinalizer)
 		err := retry.RetryOnConflict(retry.DefaultBackoff, func() (err error) {
-			if err := i.Client.Update(ctx, origin); err != nil {
+			if err := cluster.client.Update(ctx, origin); err != nil {
 				return err
 			}
 
@@ -107,8 +209,120 @@ func (i *TenancyController) Reconcile(ctx context.Context, request ctrl.Request)
 	}
 
 	i.Log.V(3).Info("Reconcile completed")
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: i.tokenRotationAfter(status, ctx)}, nil
+
+}
+
+type optionsKey struct{}
 
+// Returns the options of the reconciliation of the context, outside of a reconciliation the options currently in effect
+func (i *TenancyController) options(ctx context.Context) TenancyControllerOptions {
+	if options, ok := ctx.Value(optionsKey{}).(*TenancyControllerOptions); ok {
+		return *options
+	}
+
+	if current := i.current.Load(); current != nil {
+		return *current
+	}
+
+	return i.Options
+}
+
+// Returns a context carrying a snapshot of the options in effect, so a configuration applied during the
+// reconciliation does not mix the old and the new options
+func (i *TenancyController) withOptions(ctx context.Context) context.Context {
+	options := i.options(ctx)
+	return context.WithValue(ctx, optionsKey{}, &options)
+}
+
+// Applies the configuration on top of the default options. All tenants are
+// re-enqueued when the effective options changed.
+func (i *TenancyController) configure(ctx context.Context, spec *tenancyv1alpha1.TenancyControllerConfigurationSpec) error {
+	options := i.Options
+	if spec != nil {
+		if spec.CapsuleProxy.ServiceName != "" {
+			options.CapsuleProxyServiceName = spec.CapsuleProxy.ServiceName
+		}
+		if spec.CapsuleProxy.ServiceNamespace != "" {
+			options.CapsuleProxyServiceNamespace = spec.CapsuleProxy.ServiceNamespace
+		}
+		if spec.CapsuleProxy.ServicePort != 0 {
+			options.CapsuleProxyServicePort = spec.CapsuleProxy.ServicePort
+		}
+		if spec.CapsuleProxy.ServerName != "" {
+			options.CapsuleProxyServerName = spec.CapsuleProxy.ServerName
+		}
+		if spec.CapsuleProxy.CA != nil {
+			options.CapsuleProxyCA = spec.CapsuleProxy.CA
+		}
+		if spec.ArgoCDNamespace != "" {
+			options.ArgoCDNamespace = spec.ArgoCDNamespace
+		}
+		if len(spec.ArgoCDInstances) > 0 {
+			options.ArgoCDInstances = spec.ArgoCDInstances
+		}
+		if spec.UserTenantNamespace != "" {
+			options.UserTenantNamespace = spec.UserTenantNamespace
+		}
+		if spec.SystemTenantNamespace != "" {
+			options.SystemTenantNamespace = spec.SystemTenantNamespace
+		}
+		if len(spec.Roles) > 0 {
+			options.Roles = spec.Roles
+		}
+		if len(spec.AllowedOverrides) > 0 {
+			options.AllowedOverrides = spec.AllowedOverrides
+		}
+		if spec.TokenTTL != nil {
+			// The TokenRequest API does not issue tokens valid for less than 10 minutes
+			if spec.TokenTTL.Duration < 10*time.Minute {
+				return fmt.Errorf("token ttl must be at least 10m, got %s", spec.TokenTTL.Duration)
+			}
+			options.TokenTTL = spec.TokenTTL.Duration
+		}
+		if spec.DeletionPolicy != "" {
+			options.DeletionPolicy = spec.DeletionPolicy
+		}
+		if spec.ArchiveRetention != nil {
+			options.ArchiveRetention = spec.ArchiveRetention.Duration
+		}
+		if spec.ApplicationDeletionPolicy != "" {
+			options.ApplicationDeletionPolicy = spec.ApplicationDeletionPolicy
+		}
+		if spec.AppsNamespace != nil {
+			options.AppsNamespace = *spec.AppsNamespace
+		}
+		if spec.CIRole != nil {
+			options.CIRole = spec.CIRole
+		}
+		if spec.CITokenTTL != nil {
+			// Tokens are re-issued when a third of their lifetime remains
+			if spec.CITokenTTL.Duration < 10*time.Minute {
+				return fmt.Errorf("ci token ttl must be at least 10m, got %s", spec.CITokenTTL.Duration)
+			}
+			options.CITokenTTL = spec.CITokenTTL.Duration
+		}
+		if spec.ProjectTemplate != "" {
+			if err := project.ValidateTemplate(spec.ProjectTemplate); err != nil {
+				return fmt.Errorf("invalid project template: %w", err)
+			}
+			options.ProjectTemplate = spec.ProjectTemplate
+		}
+	}
+
+	previous := i.current.Swap(&options)
+	if previous == nil || reflect.DeepEqual(*previous, options) {
+		return nil
+	}
+
+	i.Log.V(3).Info("Options changed, re-enqueue all tenants")
+
+	select {
+	case i.reload <- event.GenericEvent{Object: &tenancyv1alpha1.TenancyControllerConfiguration{}}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (r *TenancyController) updateTenantStatus(ctx context.Context, tnt *capsulev1beta2.Tenant) error {
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestOptionsSnapshot(t *testing.T) {
+	tenancy := &TenancyController{
+		Log:     logr.Discard(),
+		Options: TenancyControllerOptions{ArgoCDNamespace: "argocd", TokenTTL: time.Hour},
+		reload:  make(chan event.GenericEvent, 1),
+	}
+	ctx := context.Background()
+	if err := tenancy.configure(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	reconciliation := tenancy.withOptions(ctx)
+
+	// A configuration applied during the reconciliation takes effect with the next one
+	if err := tenancy.configure(ctx, &tenancyv1alpha1.TenancyControllerConfigurationSpec{ArgoCDNamespace: "gitops", TokenTTL: &metav1.Duration{Duration: 2 * time.Hour}}); err != nil {
+		t.Fatal(err)
+	}
+	if options := tenancy.options(reconciliation); options.ArgoCDNamespace != "argocd" || options.TokenTTL != time.Hour {
+		t.Fatalf("options of the running reconciliation changed to %s, %s", options.ArgoCDNamespace, options.TokenTTL)
+	}
+	if options := tenancy.options(tenancy.withOptions(ctx)); options.ArgoCDNamespace != "gitops" || options.TokenTTL != 2*time.Hour {
+		t.Fatalf("options of the next reconciliation are %s, %s", options.ArgoCDNamespace, options.TokenTTL)
+	}
+}
+
+func TestTokenTTLMinimum(t *testing.T) {
+	tenancy := &TenancyController{
+		Log:     logr.Discard(),
+		Options: TenancyControllerOptions{ArgoCDNamespace: "argocd", TokenTTL: time.Hour},
+		reload:  make(chan event.GenericEvent, 1),
+	}
+
+	spec := &tenancyv1alpha1.TenancyControllerConfigurationSpec{TokenTTL: &metav1.Duration{Duration: 5 * time.Minute}}
+	if err := tenancy.configure(context.Background(), spec); err == nil {
+		t.Fatal("token ttl below 10m accepted")
+	}
+}
+
+func TestInvalidProjectTemplate(t *testing.T) {
+	tenancy := &TenancyController{
+		Log:     logr.Discard(),
+		Options: TenancyControllerOptions{ArgoCDNamespace: "argocd", TokenTTL: time.Hour},
+		reload:  make(chan event.GenericEvent, 1),
+	}
+
+	for _, projectTemplate := range []string{"{{ .Tenant.Name", "apiVersion: v1\nkind: ConfigMap", "spec:\n  sourceRepos: {{ .Tenant.Missing }}"} {
+		spec := &tenancyv1alpha1.TenancyControllerConfigurationSpec{ProjectTemplate: projectTemplate}
+		if err := tenancy.configure(context.Background(), spec); err == nil {
+			t.Errorf("project template %q accepted", projectTemplate)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// Key of the command parameters ConfigMap listing the namespaces Argo CD watches for Applications
+const applicationNamespacesKey = "application.namespaces"
+
+// Lists the entries of application.namespaces added by the controller, entries of others are kept
+const ApplicationNamespacesAnnotation = "tenancy.gelan.cloud/application-namespaces"
+
+// Pod template annotation kubectl rollout restart sets, changing it rolls the pods of a workload
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// Names of the Argo CD components which read application.namespaces when they start
+var applicationNamespacesComponents = []string{"argocd-server", "argocd-application-controller"}
+
+func appsNamespaceName(tenant string) string {
+	return tenant + "-apps"
+}
+
+// Creates the namespace for the Applications of the tenant. It is owned by the tenant, so Capsule assigns it
+// to the tenant, and matches the sourceNamespaces of the tenant's AppProject.
+func (i *TenancyController) tenantAppsNamespace(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, ctx context.Context) error {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: appsNamespaceName(tenant.Name),
+		},
+	}
+
+	tenantLabel, err := capsulev1beta2.GetTypeLabel(&capsulev1beta2.Tenant{})
+	if err != nil {
+		return err
+	}
+
+	result, err := controllerutil.CreateOrUpdate(ctx, cluster.client, namespace, func() error {
+		if owner, found := namespace.Labels[tenantLabel]; found && owner != tenant.Name {
+			return fmt.Errorf("namespace %s belongs to tenant %s", namespace.Name, owner)
+		}
+
+		cluster.setTenantMetadata(namespace, tenant)
+		namespace.Labels[tenantLabel] = tenant.Name
+
+		return controllerutil.SetControllerReference(tenant, namespace, cluster.client.Scheme())
+	})
+	cluster.recordStep(tenant, StepAppsNamespace, namespace, result, err)
+	if err != nil {
+		return err
+	}
+
+	i.Log.V(5).Info("Apps namespace created", "name", tenant.Name, "namespace", namespace.Name)
+
+	return nil
+}
+
+// Signals that an AppProject was written or removed, without blocking when the signal is pending
+func (i *TenancyController) changedProjects() {
+	select {
+	case i.projectsChanged <- struct{}{}:
+	default:
+	}
+}
+
+// ApplicationNamespaces maintains application.namespaces in the command parameters ConfigMap of the Argo CD
+// instances from the sourceNamespaces of the managed AppProjects, so Argo CD watches the tenants' namespaces.
+// Changes of AppProjects are collected for the batch interval before the ConfigMaps are updated.
+type ApplicationNamespaces struct {
+	Tenancy       *TenancyController
+	Log           logr.Logger
+	BatchInterval time.Duration
+	// Restarts the Argo CD server and application controller after application.namespaces changed
+	Restart bool
+
+	// Instances whose restart failed, it is retried with the next sync
+	restartPending map[string]bool
+}
+
+func (n *ApplicationNamespaces) SetupWithManager(mgr ctrl.Manager) error {
+	if n.BatchInterval <= 0 {
+		return nil
+	}
+
+	n.Tenancy.projectsChanged = make(chan struct{}, 1)
+
+	return mgr.Add(n)
+}
+
+// Only the leader updates the ConfigMaps
+func (n *ApplicationNamespaces) NeedLeaderElection() bool {
+	return true
+}
+
+func (n *ApplicationNamespaces) Start(ctx context.Context) error {
+	// The AppProjects may have changed while another replica was leading
+	batch := time.After(0)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-n.Tenancy.projectsChanged:
+			if batch == nil {
+				batch = time.After(n.BatchInterval)
+			}
+		case <-batch:
+			batch = nil
+			if err := n.sync(ctx); err != nil {
+				n.Log.Error(err, "Unable to update application namespaces")
+				batch = time.After(n.BatchInterval)
+			}
+		}
+	}
+}
+
+// Updates the application namespaces of every Argo CD instance
+func (n *ApplicationNamespaces) sync(ctx context.Context) error {
+	ctx = n.Tenancy.withOptions(ctx)
+	for _, instance := range n.Tenancy.argoInstances(ctx) {
+		if err := n.syncInstance(instance, ctx); err != nil {
+			return fmt.Errorf("argo instance %s: %w", instance.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Replaces the entries the controller added to application.namespaces with the sourceNamespaces of the
+// managed AppProjects of the instance, including those kept from deleted tenants
+func (n *ApplicationNamespaces) syncInstance(instance tenancyv1alpha1.ArgoCDInstanceSpec, ctx context.Context) error {
+	projects := &unstructured.UnstructuredList{}
+	projects.SetAPIVersion("argoproj.io/v1alpha1")
+	projects.SetKind("AppProjectList")
+	if err := n.Tenancy.Client.List(ctx, projects, client.InNamespace(instance.Namespace), client.MatchingLabels(utils.CommonLabels()), client.HasLabels{utils.TenantLabel}); err != nil {
+		return err
+	}
+
+	desired := []string{}
+	for _, appProject := range projects.Items {
+		sourceNamespaces, _, err := unstructured.NestedStringSlice(appProject.Object, "spec", "sourceNamespaces")
+		if err != nil {
+			return err
+		}
+		desired = utils.AppendUnique(desired, sourceNamespaces...)
+	}
+	sort.Strings(desired)
+
+	changed := false
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		configmap := &corev1.ConfigMap{}
+		err := n.Tenancy.Client.Get(ctx, client.ObjectKey{Name: cmdParamsConfigMapName(instance), Namespace: instance.Namespace}, configmap)
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		found := err == nil
+
+		managed := splitNamespaces(configmap.Annotations[ApplicationNamespacesAnnotation])
+		current := splitNamespaces(configmap.Data[applicationNamespacesKey])
+
+		namespaces := []string{}
+		for _, namespace := range current {
+			if utils.StringSliceContains(managed, namespace) && !utils.StringSliceContains(desired, namespace) {
+				continue
+			}
+			namespaces = append(namespaces, namespace)
+		}
+		namespaces = utils.AppendUnique(namespaces, desired...)
+
+		// Entries which were configured before are not taken over
+		added := []string{}
+		for _, namespace := range desired {
+			if utils.StringSliceContains(managed, namespace) || !utils.StringSliceContains(current, namespace) {
+				added = append(added, namespace)
+			}
+		}
+
+		if found && strings.Join(namespaces, ",") == strings.Join(current, ",") && strings.Join(added, ",") == strings.Join(managed, ",") {
+			return nil
+		}
+
+		configmap.Name = cmdParamsConfigMapName(instance)
+		configmap.Namespace = instance.Namespace
+		if configmap.Data == nil {
+			configmap.Data = map[string]string{}
+		}
+		configmap.Data[applicationNamespacesKey] = strings.Join(namespaces, ",")
+		if configmap.Annotations == nil {
+			configmap.Annotations = map[string]string{}
+		}
+		configmap.Annotations[ApplicationNamespacesAnnotation] = strings.Join(added, ",")
+
+		if found {
+			err = n.Tenancy.Client.Update(ctx, configmap)
+		} else {
+			err = n.Tenancy.Client.Create(ctx, configmap)
+			if apierrors.IsAlreadyExists(err) {
+				err = apierrors.NewConflict(corev1.Resource("configmaps"), configmap.Name, err)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		changed = true
+		n.Log.Info("Application namespaces updated", "instance", instance.Name, "configmap", client.ObjectKeyFromObject(configmap).String(), "namespaces", configmap.Data[applicationNamespacesKey])
+
+		return nil
+	})
+	if err != nil || !changed && !n.restartPending[instance.Name] {
+		return err
+	}
+
+	// Argo CD reads the command parameters when it starts
+	if !n.Restart {
+		n.Log.Info("Restart the Argo CD server and application controller to apply the application namespaces", "instance", instance.Name)
+		return nil
+	}
+
+	if n.restartPending == nil {
+		n.restartPending = map[string]bool{}
+	}
+	n.restartPending[instance.Name] = true
+	if err := n.restart(instance, ctx); err != nil {
+		return err
+	}
+	delete(n.restartPending, instance.Name)
+
+	return nil
+}
+
+// Rolls the pods of the Argo CD server and application controller of the instance, like kubectl rollout restart.
+// The components are found by their app.kubernetes.io/name label, which the manifests and the chart of Argo CD set.
+func (n *ApplicationNamespaces) restart(instance tenancyv1alpha1.ArgoCDInstanceSpec, ctx context.Context) error {
+	selector, err := labels.Parse("app.kubernetes.io/name in (" + strings.Join(applicationNamespacesComponents, ",") + ")")
+	if err != nil {
+		return err
+	}
+	options := []client.ListOption{client.InNamespace(instance.Namespace), client.MatchingLabelsSelector{Selector: selector}}
+
+	deployments := &appsv1.DeploymentList{}
+	if err := n.Tenancy.Client.List(ctx, deployments, options...); err != nil {
+		return err
+	}
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := n.Tenancy.Client.List(ctx, statefulSets, options...); err != nil {
+		return err
+	}
+
+	workloads := []client.Object{}
+	templates := []*corev1.PodTemplateSpec{}
+	for idx := range deployments.Items {
+		workloads = append(workloads, &deployments.Items[idx])
+		templates = append(templates, &deployments.Items[idx].Spec.Template)
+	}
+	for idx := range statefulSets.Items {
+		workloads = append(workloads, &statefulSets.Items[idx])
+		templates = append(templates, &statefulSets.Items[idx].Spec.Template)
+	}
+
+	restartedAt := time.Now().UTC().Format(time.RFC3339)
+	for idx, workload := range workloads {
+		patch := client.MergeFrom(workload.DeepCopyObject().(client.Object))
+		if templates[idx].Annotations == nil {
+			templates[idx].Annotations = map[string]string{}
+		}
+		templates[idx].Annotations[restartedAtAnnotation] = restartedAt
+
+		if err := n.Tenancy.Client.Patch(ctx, workload, patch); err != nil {
+			return fmt.Errorf("restart %s/%s: %w", workload.GetNamespace(), workload.GetName(), err)
+		}
+		n.Log.Info("Argo CD component restarted", "instance", instance.Name, "name", workload.GetName())
+	}
+
+	return nil
+}
+
+func splitNamespaces(value string) []string {
+	namespaces := []string{}
+	for _, namespace := range strings.Split(value, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = utils.AppendUnique(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestApplicationNamespacesRestart(t *testing.T) {
+	appProject := &unstructured.Unstructured{}
+	appProject.SetAPIVersion("argoproj.io/v1alpha1")
+	appProject.SetKind("AppProject")
+	appProject.SetName("solar")
+	appProject.SetNamespace("argocd")
+	labels := utils.CommonLabels()
+	labels[utils.TenantLabel] = "solar"
+	appProject.SetLabels(labels)
+	if err := unstructured.SetNestedStringSlice(appProject.Object, []string{"solar-*"}, "spec", "sourceNamespaces"); err != nil {
+		t.Fatal(err)
+	}
+
+	component := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "argocd", Labels: map[string]string{"app.kubernetes.io/name": name}}
+	}
+	c := newFakeClient(t,
+		appProject,
+		&appsv1.Deployment{ObjectMeta: component("argocd-server")},
+		&appsv1.StatefulSet{ObjectMeta: component("argocd-application-controller")},
+		&appsv1.Deployment{ObjectMeta: component("argocd-repo-server")},
+	)
+
+	namespaces := &ApplicationNamespaces{
+		Tenancy: &TenancyController{
+			Client:  c,
+			Log:     logr.Discard(),
+			Options: TenancyControllerOptions{ArgoCDNamespace: "argocd"},
+		},
+		Log:     logr.Discard(),
+		Restart: true,
+	}
+	ctx := context.Background()
+	instance := tenancyv1alpha1.ArgoCDInstanceSpec{Name: "default", Namespace: "argocd"}
+
+	restartedAt := func(object client.Object, template *corev1.PodTemplateSpec) string {
+		t.Helper()
+		if err := c.Get(ctx, client.ObjectKeyFromObject(object), object); err != nil {
+			t.Fatal(err)
+		}
+		return template.Annotations[restartedAtAnnotation]
+	}
+	server := &appsv1.Deployment{ObjectMeta: component("argocd-server")}
+	controller := &appsv1.StatefulSet{ObjectMeta: component("argocd-application-controller")}
+	repoServer := &appsv1.Deployment{ObjectMeta: component("argocd-repo-server")}
+
+	if err := namespaces.syncInstance(instance, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	configmap := &corev1.ConfigMap{}
+	if err := c.Get(ctx, client.ObjectKey{Name: "argocd-cmd-params-cm", Namespace: "argocd"}, configmap); err != nil {
+		t.Fatal(err)
+	}
+	if configmap.Data[applicationNamespacesKey] != "solar-*" {
+		t.Fatalf("application.namespaces = %q, want solar-*", configmap.Data[applicationNamespacesKey])
+	}
+
+	first := restartedAt(server, &server.Spec.Template)
+	if first == "" || restartedAt(controller, &controller.Spec.Template) == "" {
+		t.Fatal("argo cd server and application controller not restarted")
+	}
+	if restartedAt(repoServer, &repoServer.Spec.Template) != "" {
+		t.Fatal("repo server restarted")
+	}
+
+	// Unchanged namespaces do not restart Argo CD
+	server.Spec.Template.Annotations[restartedAtAnnotation] = "unchanged"
+	if err := c.Update(ctx, server); err != nil {
+		t.Fatal(err)
+	}
+	if err := namespaces.syncInstance(instance, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := restartedAt(server, &server.Spec.Template); got != "unchanged" {
+		t.Fatalf("argo cd server restarted without a change, restartedAt = %q", got)
+	}
+}
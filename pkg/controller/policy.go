@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Applied to Tenants which are neither selected by a policy nor covered by a default policy
+var builtinTenantPolicy = tenancyv1alpha1.ArgoTenantPolicySpec{
+	SourceRepos: []string{"*"},
+	ClusterResourceWhitelist: []metav1.GroupKind{
+		{Group: "*", Kind: "*"},
+	},
+	NamespaceResourceWhitelist: []metav1.GroupKind{
+		{Group: "*", Kind: "*"},
+	},
+}
+
+// Returns the merged policy of all ArgoTenantPolicies applying to the tenant
+func (i *TenancyController) tenantPolicy(tenant *capsulev1beta2.Tenant, ctx context.Context) (*tenancyv1alpha1.ArgoTenantPolicySpec, error) {
+	policies := &tenancyv1alpha1.ArgoTenantPolicyList{}
+	if err := i.Client.List(ctx, policies); err != nil {
+		return nil, err
+	}
+
+	return mergeTenantPolicies(tenant, policies.Items)
+}
+
+// Merges the policies selecting the tenant, or the default policies if none does. The lists are joined, so a policy of
+// higher priority can not narrow what a policy of lower priority allows, only orphanedResources is taken by priority.
+func mergeTenantPolicies(tenant *capsulev1beta2.Tenant, policies []tenancyv1alpha1.ArgoTenantPolicy) (*tenancyv1alpha1.ArgoTenantPolicySpec, error) {
+	selected := []tenancyv1alpha1.ArgoTenantPolicy{}
+	defaults := []tenancyv1alpha1.ArgoTenantPolicy{}
+
+	for _, policy := range policies {
+		if policy.Spec.Default {
+			defaults = append(defaults, policy)
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(policy.Spec.TenantSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tenant selector in policy %s: %w", policy.Name, err)
+		}
+
+		if selector.Matches(labels.Set(tenant.Labels)) {
+			selected = append(selected, policy)
+		}
+	}
+
+	if len(selected) == 0 {
+		selected = defaults
+	}
+
+	if len(selected) == 0 {
+		return builtinTenantPolicy.DeepCopy(), nil
+	}
+
+	sort.SliceStable(selected, func(a, b int) bool {
+		if selected[a].Spec.Priority != selected[b].Spec.Priority {
+			return selected[a].Spec.Priority > selected[b].Spec.Priority
+		}
+		return selected[a].Name < selected[b].Name
+	})
+
+	merged := &tenancyv1alpha1.ArgoTenantPolicySpec{}
+	for _, policy := range selected {
+		merged.SourceRepos = utils.AppendUnique(merged.SourceRepos, policy.Spec.SourceRepos...)
+		merged.ClusterResourceWhitelist = utils.AppendUnique(merged.ClusterResourceWhitelist, policy.Spec.ClusterResourceWhitelist...)
+		merged.ClusterResourceBlacklist = utils.AppendUnique(merged.ClusterResourceBlacklist, policy.Spec.ClusterResourceBlacklist...)
+		merged.NamespaceResourceWhitelist = utils.AppendUnique(merged.NamespaceResourceWhitelist, policy.Spec.NamespaceResourceWhitelist...)
+		merged.NamespaceResourceBlacklist = utils.AppendUnique(merged.NamespaceResourceBlacklist, policy.Spec.NamespaceResourceBlacklist...)
+		merged.SignatureKeys = utils.AppendUnique(merged.SignatureKeys, policy.Spec.SignatureKeys...)
+
+		if merged.OrphanedResources == nil && policy.Spec.OrphanedResources != nil {
+			merged.OrphanedResources = policy.Spec.OrphanedResources.DeepCopy()
+		}
+	}
+
+	return merged, nil
+}
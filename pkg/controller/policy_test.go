@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func testTenantPolicy(name string, selector *metav1.LabelSelector, spec tenancyv1alpha1.ArgoTenantPolicySpec) tenancyv1alpha1.ArgoTenantPolicy {
+	spec.TenantSelector = selector
+	return tenancyv1alpha1.ArgoTenantPolicy{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: spec}
+}
+
+func TestMergeTenantPolicies(t *testing.T) {
+	solar := &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "solar"}}
+	all := &metav1.LabelSelector{}
+	warn := &tenancyv1alpha1.OrphanedResourcesMonitorSettings{Warn: ptr.To(true)}
+	silent := &tenancyv1alpha1.OrphanedResourcesMonitorSettings{Warn: ptr.To(false)}
+
+	tests := []struct {
+		name     string
+		policies []tenancyv1alpha1.ArgoTenantPolicy
+		want     *tenancyv1alpha1.ArgoTenantPolicySpec
+	}{
+		{
+			name: "built-in policy without policies",
+			want: &builtinTenantPolicy,
+		},
+		{
+			name: "built-in policy without matching or default policy",
+			policies: []tenancyv1alpha1.ArgoTenantPolicy{
+				testTenantPolicy("lunar", &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "lunar"}}, tenancyv1alpha1.ArgoTenantPolicySpec{SourceRepos: []string{"https://git.example.com/lunar/*"}}),
+				testTenantPolicy("omitted-selector", nil, tenancyv1alpha1.ArgoTenantPolicySpec{SourceRepos: []string{"https://git.example.com/*"}}),
+			},
+			want: &builtinTenantPolicy,
+		},
+		{
+			name: "default policy without matching policy",
+			policies: []tenancyv1alpha1.ArgoTenantPolicy{
+				testTenantPolicy("lunar", &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "lunar"}}, tenancyv1alpha1.ArgoTenantPolicySpec{SourceRepos: []string{"https://git.example.com/lunar/*"}}),
+				testTenantPolicy("fallback", nil, tenancyv1alpha1.ArgoTenantPolicySpec{Default: true, SourceRepos: []string{"https://git.example.com/shared/*"}}),
+			},
+			want: &tenancyv1alpha1.ArgoTenantPolicySpec{SourceRepos: []string{"https://git.example.com/shared/*"}},
+		},
+		{
+			name: "default policy ignored when a policy matches",
+			policies: []tenancyv1alpha1.ArgoTenantPolicy{
+				testTenantPolicy("fallback", all, tenancyv1alpha1.ArgoTenantPolicySpec{Default: true, SourceRepos: []string{"https://git.example.com/shared/*"}}),
+				testTenantPolicy("solar", solar, tenancyv1alpha1.ArgoTenantPolicySpec{SourceRepos: []string{"https://git.example.com/solar/*"}}),
+			},
+			want: &tenancyv1alpha1.ArgoTenantPolicySpec{SourceRepos: []string{"https://git.example.com/solar/*"}},
+		},
+		{
+			name: "lists joined by priority and name",
+			policies: []tenancyv1alpha1.ArgoTenantPolicy{
+				testTenantPolicy("b-all", all, tenancyv1alpha1.ArgoTenantPolicySpec{
+					SourceRepos:                []string{"https://git.example.com/shared/*", "https://git.example.com/solar/*"},
+					NamespaceResourceBlacklist: []metav1.GroupKind{{Group: "", Kind: "ResourceQuota"}},
+				}),
+				testTenantPolicy("a-all", all, tenancyv1alpha1.ArgoTenantPolicySpec{SourceRepos: []string{"https://git.example.com/platform/*"}}),
+				testTenantPolicy("solar", solar, tenancyv1alpha1.ArgoTenantPolicySpec{
+					Priority:                   10,
+					SourceRepos:                []string{"https://git.example.com/solar/*"},
+					NamespaceResourceWhitelist: []metav1.GroupKind{{Group: "apps", Kind: "Deployment"}},
+				}),
+			},
+			want: &tenancyv1alpha1.ArgoTenantPolicySpec{
+				SourceRepos:                []string{"https://git.example.com/solar/*", "https://git.example.com/platform/*", "https://git.example.com/shared/*"},
+				NamespaceResourceWhitelist: []metav1.GroupKind{{Group: "apps", Kind: "Deployment"}},
+				NamespaceResourceBlacklist: []metav1.GroupKind{{Group: "", Kind: "ResourceQuota"}},
+			},
+		},
+		{
+			name: "orphaned resources of the first policy which sets them",
+			policies: []tenancyv1alpha1.ArgoTenantPolicy{
+				testTenantPolicy("low", all, tenancyv1alpha1.ArgoTenantPolicySpec{OrphanedResources: silent}),
+				testTenantPolicy("high", solar, tenancyv1alpha1.ArgoTenantPolicySpec{Priority: 10, OrphanedResources: warn}),
+				testTenantPolicy("highest", solar, tenancyv1alpha1.ArgoTenantPolicySpec{Priority: 20, SourceRepos: []string{"https://git.example.com/solar/*"}}),
+			},
+			want: &tenancyv1alpha1.ArgoTenantPolicySpec{SourceRepos: []string{"https://git.example.com/solar/*"}, OrphanedResources: warn},
+		},
+	}
+
+	tenant := &capsulev1beta2.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "solar", Labels: map[string]string{"tenant": "solar"}}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := mergeTenantPolicies(tenant, test.policies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("merged policy = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMergeTenantPoliciesInvalidSelector(t *testing.T) {
+	tenant := &capsulev1beta2.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "solar"}}
+	invalid := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tenant", Operator: "Matches"}}}
+
+	if _, err := mergeTenantPolicies(tenant, []tenancyv1alpha1.ArgoTenantPolicy{testTenantPolicy("invalid", invalid, tenancyv1alpha1.ArgoTenantPolicySpec{})}); err == nil {
+		t.Fatal("invalid tenant selector accepted")
+	}
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/argocd"
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// Token written into rendered cluster secrets instead of a requested one
+const RenderedToken = "RENDERED_TOKEN"
+
+// RenderClient returns the in-memory cluster holding the seed objects. Every object written to it is passed
+// to collect, token requests are answered with the RenderedToken.
+type RenderClient func(seed []client.Object, collect func(c client.Client, object client.Object) error) client.Client
+
+// Render provisions the Tenants among the objects in the in-memory cluster of newClient and returns every
+// artifact the controller writes, in the order they are written. The configuration is read from the
+// TenancyControllerConfiguration of the given name, if it is among the objects.
+func Render(ctx context.Context, options TenancyControllerOptions, configurationName string, objects []client.Object, newClient RenderClient, log logr.Logger) ([]*unstructured.Unstructured, error) {
+	tenancy := &TenancyController{
+		Log:      log,
+		Recorder: &record.FakeRecorder{},
+		Options:  options,
+		// Project tokens can not be issued offline
+		argoClient: func(tenancyv1alpha1.ArgoCDInstanceSpec, context.Context) (argocd.Client, error) {
+			return renderedArgoClient{}, nil
+		},
+	}
+
+	tenants := []*capsulev1beta2.Tenant{}
+	for _, object := range objects {
+		switch typed := object.(type) {
+		case *capsulev1beta2.Tenant:
+			tenants = append(tenants, typed)
+		case *tenancyv1alpha1.TenancyControllerConfiguration:
+			if typed.Name == configurationName {
+				if err := tenancy.configure(ctx, &typed.Spec); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// The policies are written into the existing RBAC ConfigMaps
+	seed := append([]client.Object{}, objects...)
+	for _, instance := range tenancy.argoInstances(ctx) {
+		if !containsObject(objects, "ConfigMap", instance.Namespace, rbacConfigMapName(instance)) {
+			seed = append(seed, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: rbacConfigMapName(instance), Namespace: instance.Namespace},
+				Data:       map[string]string{},
+			})
+		}
+	}
+
+	written := []client.Object{}
+	collect := func(c client.Client, object client.Object) error {
+		// Tenants only gain their ServiceAccount as owner
+		if _, isTenant := object.(*capsulev1beta2.Tenant); isTenant {
+			return nil
+		}
+
+		gvk, err := apiutil.GVKForObject(object, c.Scheme())
+		if err != nil {
+			return err
+		}
+		object = object.DeepCopyObject().(client.Object)
+		object.GetObjectKind().SetGroupVersionKind(gvk)
+
+		for idx, existing := range written {
+			if existing.GetObjectKind().GroupVersionKind() == gvk && client.ObjectKeyFromObject(existing) == client.ObjectKeyFromObject(object) {
+				written[idx] = object
+				return nil
+			}
+		}
+		written = append(written, object)
+
+		return nil
+	}
+
+	tenancy.Client = newClient(seed, collect)
+
+	cluster := tenancy.tenantCluster("")
+	for _, tenant := range tenants {
+		status := &tenancyv1alpha1.TenantArgoBindingStatus{}
+		if err := tenancy.reconcileAddons(tenant.DeepCopy(), cluster, status, ctx); err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tenant.Name, err)
+		}
+	}
+
+	artifacts := make([]*unstructured.Unstructured, 0, len(written))
+	for _, object := range written {
+		fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(object)
+		if err != nil {
+			return nil, err
+		}
+		artifact := &unstructured.Unstructured{Object: fields}
+
+		// Drop the fields set by the in-memory cluster
+		artifact.SetResourceVersion("")
+		unstructured.RemoveNestedField(artifact.Object, "metadata", "creationTimestamp")
+		unstructured.RemoveNestedField(artifact.Object, "status")
+
+		// Secrets are printed readable
+		if data, found, _ := unstructured.NestedStringMap(artifact.Object, "data"); found && artifact.GetKind() == "Secret" {
+			for key, value := range data {
+				decoded, err := base64.StdEncoding.DecodeString(value)
+				if err != nil {
+					return nil, err
+				}
+				data[key] = string(decoded)
+			}
+			unstructured.RemoveNestedField(artifact.Object, "data")
+			if err := unstructured.SetNestedStringMap(artifact.Object, data, "stringData"); err != nil {
+				return nil, err
+			}
+		}
+
+		artifacts = append(artifacts, artifact)
+	}
+
+	return artifacts, nil
+}
+
+func containsObject(objects []client.Object, kind string, namespace string, name string) bool {
+	for _, object := range objects {
+		if object.GetObjectKind().GroupVersionKind().Kind == kind && object.GetNamespace() == namespace && object.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Issues the rendered token for every project role
+type renderedArgoClient struct{}
+
+func (renderedArgoClient) CreateProjectToken(context.Context, string, string, string, string, time.Duration) (string, error) {
+	return RenderedToken, nil
+}
+
+func (renderedArgoClient) DeleteProjectToken(context.Context, string, string, string, int64) error {
+	return nil
+}
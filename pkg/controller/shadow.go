@@ -0,0 +1,287 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/pkg/metrics"
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// Operations a shadow reconciliation would have applied
+const (
+	ShadowCreate = "create"
+	ShadowUpdate = "update"
+	ShadowDelete = "delete"
+)
+
+// Maximum number of changed paths listed in a shadow Event, the log lists all of them
+const shadowEventPaths = 10
+
+// shadowChange is a field whose live value differs from the value the controller would write
+type shadowChange struct {
+	Path    string      `json:"path"`
+	Live    interface{} `json:"live,omitempty"`
+	Desired interface{} `json:"desired,omitempty"`
+}
+
+// shadowDiff is a write the controller would have applied to an object
+type shadowDiff struct {
+	Operation string         `json:"operation"`
+	Kind      string         `json:"kind"`
+	Namespace string         `json:"namespace,omitempty"`
+	Name      string         `json:"name"`
+	Changes   []shadowChange `json:"changes,omitempty"`
+}
+
+// shadowReport collects the writes of a single shadow reconciliation
+type shadowReport struct {
+	diffs []shadowDiff
+}
+
+type shadowReportKey struct{}
+
+// shadowClient computes the writes of the controller against the live objects instead of applying them.
+// The writes are added to the shadowReport of the context, reads are passed through.
+type shadowClient struct {
+	client.Client
+	log logr.Logger
+}
+
+func newShadowClient(c client.Client, log logr.Logger) client.Client {
+	return &shadowClient{Client: c, log: log}
+}
+
+func (c *shadowClient) Create(ctx context.Context, obj client.Object, _ ...client.CreateOption) error {
+	c.record(ctx, ShadowCreate, obj, nil)
+	return nil
+}
+
+func (c *shadowClient) Update(ctx context.Context, obj client.Object, _ ...client.UpdateOption) error {
+	return c.update(ctx, obj, "")
+}
+
+func (c *shadowClient) Patch(ctx context.Context, obj client.Object, _ client.Patch, _ ...client.PatchOption) error {
+	return c.update(ctx, obj, "")
+}
+
+func (c *shadowClient) Delete(ctx context.Context, obj client.Object, _ ...client.DeleteOption) error {
+	c.record(ctx, ShadowDelete, obj, nil)
+	return nil
+}
+
+func (c *shadowClient) DeleteAllOf(ctx context.Context, obj client.Object, _ ...client.DeleteAllOfOption) error {
+	c.record(ctx, ShadowDelete, obj, nil)
+	return nil
+}
+
+func (c *shadowClient) Status() client.SubResourceWriter {
+	return c.SubResource("status")
+}
+
+func (c *shadowClient) SubResource(subResource string) client.SubResourceClient {
+	return &shadowSubResourceClient{SubResourceClient: c.Client.SubResource(subResource), parent: c, subResource: subResource}
+}
+
+// Compares the object with its live state and records the changed fields
+func (c *shadowClient) update(ctx context.Context, obj client.Object, subResource string) error {
+	live := obj.DeepCopyObject().(client.Object)
+	if err := c.Client.Get(ctx, client.ObjectKeyFromObject(obj), live); err != nil {
+		return err
+	}
+
+	liveFields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(live)
+	if err != nil {
+		return err
+	}
+	desiredFields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+
+	// Only the written part of the object is compared
+	if subResource != "" {
+		liveFields = map[string]interface{}{subResource: liveFields[subResource]}
+		desiredFields = map[string]interface{}{subResource: desiredFields[subResource]}
+	} else {
+		for _, fields := range []map[string]interface{}{liveFields, desiredFields} {
+			delete(fields, "status")
+			if metadata, ok := fields["metadata"].(map[string]interface{}); ok {
+				for _, key := range []string{"resourceVersion", "managedFields", "uid", "creationTimestamp", "generation", "selfLink"} {
+					delete(metadata, key)
+				}
+			}
+		}
+	}
+
+	changes := shadowChanges(liveFields, desiredFields, "", c.kind(obj) == "Secret")
+	if len(changes) > 0 {
+		c.record(ctx, ShadowUpdate, obj, changes)
+	}
+
+	return nil
+}
+
+// Adds the write to the report of the context, writes outside of a shadow reconciliation are only logged
+func (c *shadowClient) record(ctx context.Context, operation string, obj client.Object, changes []shadowChange) {
+	diff := shadowDiff{
+		Operation: operation,
+		Kind:      c.kind(obj),
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Changes:   changes,
+	}
+
+	report, ok := ctx.Value(shadowReportKey{}).(*shadowReport)
+	if !ok {
+		c.log.Info("Shadow write", "operation", diff.Operation, "kind", diff.Kind, "namespace", diff.Namespace, "name", diff.Name, "changes", diff.Changes)
+		return
+	}
+	report.diffs = append(report.diffs, diff)
+}
+
+func (c *shadowClient) kind(obj client.Object) string {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return fmt.Sprintf("%T", obj)
+	}
+	return gvk.Kind
+}
+
+// shadowSubResourceClient records the writes to a subresource, e.g. the status
+type shadowSubResourceClient struct {
+	client.SubResourceClient
+	parent      *shadowClient
+	subResource string
+}
+
+func (c *shadowSubResourceClient) Create(ctx context.Context, obj client.Object, _ client.Object, _ ...client.SubResourceCreateOption) error {
+	c.parent.record(ctx, ShadowCreate, obj, []shadowChange{{Path: c.subResource}})
+	return nil
+}
+
+func (c *shadowSubResourceClient) Update(ctx context.Context, obj client.Object, _ ...client.SubResourceUpdateOption) error {
+	return c.parent.update(ctx, obj, c.subResource)
+}
+
+func (c *shadowSubResourceClient) Patch(ctx context.Context, obj client.Object, _ client.Patch, _ ...client.SubResourcePatchOption) error {
+	return c.parent.update(ctx, obj, c.subResource)
+}
+
+// Returns the fields which differ between the live and the desired object, lists are compared as a whole.
+// The values of secrets are redacted.
+func shadowChanges(live map[string]interface{}, desired map[string]interface{}, path string, secret bool) []shadowChange {
+	keys := []string{}
+	for key := range live {
+		keys = append(keys, key)
+	}
+	for key := range desired {
+		if _, exists := live[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := []shadowChange{}
+	for _, key := range keys {
+		keyPath := shadowPath(path, key)
+
+		liveMap, liveIsMap := live[key].(map[string]interface{})
+		desiredMap, desiredIsMap := desired[key].(map[string]interface{})
+		if liveIsMap && desiredIsMap {
+			changes = append(changes, shadowChanges(liveMap, desiredMap, keyPath, secret)...)
+			continue
+		}
+
+		if reflect.DeepEqual(live[key], desired[key]) {
+			continue
+		}
+
+		change := shadowChange{Path: keyPath, Live: live[key], Desired: desired[key]}
+		if secret && (strings.HasPrefix(keyPath, "data") || strings.HasPrefix(keyPath, "stringData")) {
+			change.Live, change.Desired = redact(change.Live), redact(change.Desired)
+		}
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// Appends the key to the path, keys containing dots are quoted
+func shadowPath(path string, key string) string {
+	if strings.ContainsAny(key, "./") {
+		return path + "[" + key + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func redact(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return "<redacted>"
+}
+
+// Computes what the reconciliation of the tenant would change without applying it and reports the changes
+func (i *TenancyController) reconcileShadow(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, ctx context.Context) (ctrl.Result, error) {
+	report := &shadowReport{}
+	status := &tenancyv1alpha1.TenantArgoBindingStatus{}
+	err := i.reconcileAddons(tenant, cluster, status, context.WithValue(ctx, shadowReportKey{}, report))
+
+	i.recordShadow(tenant, cluster, report)
+
+	return ctrl.Result{}, err
+}
+
+// Records the changes of a shadow reconciliation as Events on the tenant, in the log and the metrics
+func (i *TenancyController) recordShadow(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, report *shadowReport) {
+	counts := map[string]int{ShadowCreate: 0, ShadowUpdate: 0, ShadowDelete: 0}
+
+	for _, diff := range report.diffs {
+		counts[diff.Operation]++
+
+		name := diff.Name
+		if diff.Namespace != "" {
+			name = diff.Namespace + "/" + name
+		}
+		i.Log.Info("Shadow diff", "tenant", tenant.Name, "cluster", cluster.name(), "operation", diff.Operation, "kind", diff.Kind, "object", name, "changes", diff.Changes)
+
+		message := fmt.Sprintf("%s %s would be %sd", diff.Kind, name, diff.Operation)
+		if len(diff.Changes) > 0 {
+			paths := []string{}
+			for _, change := range diff.Changes {
+				if len(paths) == shadowEventPaths {
+					paths = append(paths, fmt.Sprintf("and %d more", len(diff.Changes)-shadowEventPaths))
+					break
+				}
+				paths = append(paths, change.Path)
+			}
+			message += ": " + strings.Join(paths, ", ")
+		}
+		cluster.recorder.Event(tenant, corev1.EventTypeNormal, "Shadow"+strings.ToUpper(diff.Operation[:1])+diff.Operation[1:], message)
+	}
+
+	for operation, count := range counts {
+		metrics.ShadowChanges.WithLabelValues(cluster.argoName(tenant.Name), operation).Set(float64(count))
+	}
+}
+
+// Removes the shadow metrics of a deleted tenant, and of a tenant reconciled after shadow mode was disabled
+func forgetShadow(tenant string) {
+	for _, operation := range []string{ShadowCreate, ShadowUpdate, ShadowDelete} {
+		metrics.ShadowChanges.DeleteLabelValues(tenant, operation)
+	}
+}
@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"testing"
+
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/pkg/metrics"
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestForgetShadow(t *testing.T) {
+	tenancy := &TenancyController{Log: logr.Discard(), Recorder: record.NewFakeRecorder(10), Shadow: true}
+	tenant := &capsulev1beta2.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "solar"}}
+	cluster := tenancy.tenantCluster("")
+
+	tenancy.recordShadow(tenant, cluster, &shadowReport{diffs: []shadowDiff{{Operation: ShadowCreate, Kind: "AppProject", Namespace: "argocd", Name: "solar"}}})
+	if count := testutil.CollectAndCount(metrics.ShadowChanges); count != 3 {
+		t.Fatalf("%d shadow series, want 3", count)
+	}
+
+	forgetShadow(cluster.argoName(tenant.Name))
+	if count := testutil.CollectAndCount(metrics.ShadowChanges); count != 0 {
+		t.Fatalf("%d shadow series left", count)
+	}
+}
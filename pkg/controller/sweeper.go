@@ -0,0 +1,449 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/roles"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Interval in which archived artifacts are checked for the end of their retention
+const archiveCheckInterval = time.Hour
+
+// OrphanSweeper periodically removes the artifacts of tenants which no longer exist and archives whose retention has
+// passed. Archives expire independently of the sweep, which may be disabled or in dry-run.
+type OrphanSweeper struct {
+	Tenancy  *TenancyController
+	Log      logr.Logger
+	Interval time.Duration
+	DryRun   bool
+}
+
+// orphan is an artifact whose tenant does not exist
+type orphan struct {
+	Kind       string
+	Namespace  string
+	Name       string
+	Tenant     string
+	UID        string
+	Cluster    string
+	retainedAt string
+	archivedAt string
+	// Object the events about the artifact are recorded on
+	object client.Object
+	delete func(ctx context.Context) error
+}
+
+func (s *OrphanSweeper) SetupWithManager(mgr ctrl.Manager) error {
+	return mgr.Add(s)
+}
+
+// Only the leader sweeps
+func (s *OrphanSweeper) NeedLeaderElection() bool {
+	return true
+}
+
+func (s *OrphanSweeper) Start(ctx context.Context) error {
+	// A nil channel never fires, a zero interval disables the sweep
+	var sweeps <-chan time.Time
+	if s.Interval > 0 {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		sweeps = ticker.C
+	}
+
+	expiries := time.NewTicker(archiveCheckInterval)
+	defer expiries.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sweeps:
+			if err := s.sweep(ctx); err != nil {
+				s.Log.Error(err, "Orphan sweep failed")
+			}
+		case <-expiries.C:
+			if err := s.expire(ctx); err != nil {
+				s.Log.Error(err, "Archive expiry failed")
+			}
+		}
+	}
+}
+
+// Collects the orphaned artifacts of all clusters, including retained and archived ones
+func (s *OrphanSweeper) orphans(ctx context.Context) ([]orphan, error) {
+	orphans := []orphan{}
+	for _, collect := range []func(context.Context) ([]orphan, error){
+		s.clusterOrphans,
+		s.argoOrphans,
+	} {
+		found, err := collect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, found...)
+	}
+
+	return orphans, nil
+}
+
+// Deletes the orphaned artifacts which are neither retained nor archived unless in dry-run and logs a report
+func (s *OrphanSweeper) sweep(ctx context.Context) error {
+	ctx = s.Tenancy.withOptions(ctx)
+	orphans, err := s.orphans(ctx)
+	if err != nil {
+		return err
+	}
+
+	found := 0
+	deleted := 0
+	for _, o := range orphans {
+		if s.kept(o) {
+			continue
+		}
+		found++
+
+		log := s.Log.WithValues("kind", o.Kind, "namespace", o.Namespace, "name", o.Name, "tenant", o.Tenant, "uid", o.UID, "cluster", o.Cluster)
+		if s.DryRun {
+			log.Info("Orphan found, dry-run")
+			continue
+		}
+
+		if err := o.delete(ctx); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Unable to delete orphan")
+			continue
+		}
+		log.Info("Orphan deleted")
+		deleted++
+	}
+
+	s.Log.Info("Orphan sweep completed", "orphans", found, "deleted", deleted, "dryRun", s.DryRun)
+
+	return nil
+}
+
+// Deletes the archived artifacts whose retention has passed, shadow mode and dry-run only report them
+func (s *OrphanSweeper) expire(ctx context.Context) error {
+	ctx = s.Tenancy.withOptions(ctx)
+	orphans, err := s.orphans(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range orphans {
+		if !s.expired(o, ctx) {
+			continue
+		}
+
+		log := s.Log.WithValues("kind", o.Kind, "namespace", o.Namespace, "name", o.Name, "tenant", o.Tenant, "uid", o.UID, "cluster", o.Cluster, "archivedAt", o.archivedAt)
+		if s.Tenancy.Shadow {
+			log.Info("Archive expired, shadow mode")
+			continue
+		}
+		if s.DryRun {
+			log.Info("Archive expired, dry-run")
+			if cluster := s.Tenancy.tenantCluster(o.Cluster); cluster != nil {
+				cluster.recorder.Eventf(o.object, corev1.EventTypeNormal, "ArchiveExpired", "%s %s of tenant %s expired, kept in dry-run", o.Kind, o.Name, o.Tenant)
+			}
+			continue
+		}
+
+		if err := o.delete(ctx); client.IgnoreNotFound(err) != nil {
+			log.Error(err, "Unable to delete expired archive")
+			continue
+		}
+		log.Info("Expired archive deleted")
+	}
+
+	return nil
+}
+
+// Returns whether the tenant with the uid exists in the cluster. A tenant of the same name with another uid was
+// recreated and does not own the artifact. Artifacts without uid match every tenant of the name, artifacts of clusters
+// which are not configured, e.g. while a member cluster is temporarily removed, are considered owned.
+func (s *OrphanSweeper) tenantExists(clusterName string, name string, uid string, ctx context.Context) (bool, error) {
+	cluster := s.Tenancy.tenantCluster(clusterName)
+	if cluster == nil {
+		return true, nil
+	}
+
+	tenant := &capsulev1beta2.Tenant{}
+	if err := cluster.client.Get(ctx, types.NamespacedName{Name: name}, tenant); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+
+	return uid == "" || string(tenant.UID) == uid, nil
+}
+
+// Returns whether the tenant with the uid exists in any cluster. Like tenantExists, a tenant which has artifacts
+// of a cluster which is not configured is considered to exist.
+func (s *OrphanSweeper) tenantExistsAnywhere(name string, uid string, ctx context.Context) (bool, error) {
+	for _, cluster := range s.Tenancy.tenantClusters() {
+		exists, err := s.tenantExists(cluster.name(), name, uid, ctx)
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+
+	return s.tenantInUnknownCluster(name, ctx)
+}
+
+// Returns whether cluster secrets or bindings of the tenant belong to a cluster which is not configured
+func (s *OrphanSweeper) tenantInUnknownCluster(name string, ctx context.Context) (bool, error) {
+	selector := client.MatchingLabels{utils.TenantLabel: name}
+	hasCluster := client.HasLabels{utils.ClusterLabel}
+
+	secrets := &corev1.SecretList{}
+	if err := s.Tenancy.Client.List(ctx, secrets, selector, hasCluster); err != nil {
+		return false, err
+	}
+	bindings := &tenancyv1alpha1.TenantArgoBindingList{}
+	if err := s.Tenancy.Client.List(ctx, bindings, selector, hasCluster); err != nil {
+		return false, err
+	}
+
+	objects := []client.Object{}
+	for idx := range secrets.Items {
+		objects = append(objects, &secrets.Items[idx])
+	}
+	for idx := range bindings.Items {
+		objects = append(objects, &bindings.Items[idx])
+	}
+	for _, object := range objects {
+		if s.Tenancy.tenantCluster(object.GetLabels()[utils.ClusterLabel]) == nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Collects the orphaned ServiceAccounts and Services of every cluster and the cluster secrets and bindings in this cluster
+func (s *OrphanSweeper) clusterOrphans(ctx context.Context) ([]orphan, error) {
+	selector := client.MatchingLabels(utils.CommonLabels())
+	hasTenant := client.HasLabels{utils.TenantLabel}
+
+	orphans := []orphan{}
+	collect := func(kind string, c client.Client, clusterName string, object client.Object) error {
+		if clusterName == "" {
+			clusterName = object.GetLabels()[utils.ClusterLabel]
+		}
+
+		exists, err := s.tenantExists(clusterName, object.GetLabels()[utils.TenantLabel], object.GetAnnotations()[utils.TenantUIDAnnotation], ctx)
+		if err != nil || exists {
+			return err
+		}
+
+		orphans = append(orphans, orphan{
+			Kind:       kind,
+			Namespace:  object.GetNamespace(),
+			Name:       object.GetName(),
+			Tenant:     object.GetLabels()[utils.TenantLabel],
+			UID:        object.GetAnnotations()[utils.TenantUIDAnnotation],
+			Cluster:    clusterName,
+			retainedAt: object.GetAnnotations()[utils.RetainedAnnotation],
+			archivedAt: object.GetAnnotations()[utils.ArchivedAnnotation],
+			object:     object,
+			// A tenant recreated since the artifact was listed takes it over
+			delete: func(ctx context.Context) error {
+				return c.Delete(ctx, object, client.Preconditions{ResourceVersion: ptr.To(object.GetResourceVersion())})
+			},
+		})
+
+		return nil
+	}
+
+	for _, cluster := range s.Tenancy.tenantClusters() {
+		accounts := &corev1.ServiceAccountList{}
+		if err := cluster.client.List(ctx, accounts, selector, hasTenant); err != nil {
+			return nil, err
+		}
+		for idx := range accounts.Items {
+			if err := collect("ServiceAccount", cluster.client, cluster.name(), &accounts.Items[idx]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	services := &corev1.ServiceList{}
+	if err := s.Tenancy.Client.List(ctx, services, selector, hasTenant); err != nil {
+		return nil, err
+	}
+	for idx := range services.Items {
+		if err := collect("Service", s.Tenancy.Client, "", &services.Items[idx]); err != nil {
+			return nil, err
+		}
+	}
+
+	// Cluster secrets and bindings of member cluster tenants carry the cluster label
+	secrets := &corev1.SecretList{}
+	if err := s.Tenancy.Client.List(ctx, secrets, selector, hasTenant); err != nil {
+		return nil, err
+	}
+	for idx := range secrets.Items {
+		if err := collect("Secret", s.Tenancy.Client, "", &secrets.Items[idx]); err != nil {
+			return nil, err
+		}
+	}
+
+	bindings := &tenancyv1alpha1.TenantArgoBindingList{}
+	if err := s.Tenancy.Client.List(ctx, bindings, selector, hasTenant); err != nil {
+		return nil, err
+	}
+	for idx := range bindings.Items {
+		if err := collect("TenantArgoBinding", s.Tenancy.Client, "", &bindings.Items[idx]); err != nil {
+			return nil, err
+		}
+	}
+
+	return orphans, nil
+}
+
+// Collects the orphaned AppProjects and policy csv keys of the Argo CD instances, which are shared by all clusters
+func (s *OrphanSweeper) argoOrphans(ctx context.Context) ([]orphan, error) {
+	orphans := []orphan{}
+
+	projects := &unstructured.UnstructuredList{}
+	projects.SetAPIVersion("argoproj.io/v1alpha1")
+	projects.SetKind("AppProjectList")
+	if err := s.Tenancy.Client.List(ctx, projects, client.MatchingLabels(utils.CommonLabels()), client.HasLabels{utils.TenantLabel}); err != nil {
+		return nil, err
+	}
+	for idx := range projects.Items {
+		appProject := &projects.Items[idx]
+		if s.Tenancy.namespaceInstance(appProject.GetNamespace(), ctx) == nil {
+			continue
+		}
+
+		tenant := appProject.GetLabels()[utils.TenantLabel]
+		exists, err := s.tenantExistsAnywhere(tenant, appProject.GetAnnotations()[utils.TenantUIDAnnotation], ctx)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			continue
+		}
+
+		orphans = append(orphans, orphan{
+			Kind:       "AppProject",
+			Namespace:  appProject.GetNamespace(),
+			Name:       appProject.GetName(),
+			Tenant:     tenant,
+			UID:        appProject.GetAnnotations()[utils.TenantUIDAnnotation],
+			retainedAt: appProject.GetAnnotations()[utils.RetainedAnnotation],
+			archivedAt: appProject.GetAnnotations()[utils.ArchivedAnnotation],
+			object:     appProject,
+			delete: func(ctx context.Context) error {
+				return s.Tenancy.Client.Delete(ctx, appProject, client.Preconditions{ResourceVersion: ptr.To(appProject.GetResourceVersion())})
+			},
+		})
+	}
+
+	for _, instance := range s.Tenancy.argoInstances(ctx) {
+		configmap := &corev1.ConfigMap{}
+		key := client.ObjectKey{Name: rbacConfigMapName(instance), Namespace: instance.Namespace}
+		if err := s.Tenancy.Client.Get(ctx, key, configmap); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		for policy, csv := range configmap.Data {
+			// Policies which were not written by the controller are left alone
+			tenant, found := strings.CutPrefix(policy, "policy.")
+			if !found || !strings.HasSuffix(tenant, ".csv") || !strings.HasPrefix(csv, roles.ArgoCSVHeader) {
+				continue
+			}
+			tenant = strings.TrimSuffix(tenant, ".csv")
+
+			exists, err := s.tenantExistsAnywhere(tenant, policyUID(csv), ctx)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				continue
+			}
+
+			policy := policy
+			uid := policyUID(csv)
+			orphans = append(orphans, orphan{
+				Kind:       "RBACPolicy",
+				Namespace:  key.Namespace,
+				Name:       key.Name + "/" + policy,
+				Tenant:     tenant,
+				UID:        uid,
+				retainedAt: policyMarker(csv, roles.ArgoCSVRetainedMarker),
+				archivedAt: policyMarker(csv, roles.ArgoCSVArchivedMarker),
+				object:     configmap,
+				delete: func(ctx context.Context) error {
+					return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+						if err := s.Tenancy.Client.Get(ctx, key, configmap); err != nil {
+							return err
+						}
+						if csv, exists := configmap.Data[policy]; !exists || policyUID(csv) != uid {
+							return nil
+						}
+						delete(configmap.Data, policy)
+
+						return s.Tenancy.Client.Update(ctx, configmap)
+					})
+				},
+			})
+		}
+	}
+
+	return orphans, nil
+}
+
+// Returns whether the artifact is retained or archived, the sweep leaves it alone
+func (s *OrphanSweeper) kept(o orphan) bool {
+	return o.retainedAt != "" || o.archivedAt != ""
+}
+
+// Returns whether the artifact is archived and its retention has passed. Archives with an invalid time are kept.
+func (s *OrphanSweeper) expired(o orphan, ctx context.Context) bool {
+	if o.retainedAt != "" || o.archivedAt == "" {
+		return false
+	}
+
+	archived, err := time.Parse(time.RFC3339, o.archivedAt)
+	if err != nil {
+		return false
+	}
+
+	return time.Since(archived) >= s.Tenancy.options(ctx).ArchiveRetention
+}
+
+// Returns the uid of the tenant in the header of the policy csv
+func policyUID(csv string) string {
+	header, _, _ := strings.Cut(csv, "\n")
+	_, uid, found := strings.Cut(header, "(")
+	if !found {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimSpace(uid), ")")
+}
+
+// Returns the time following the marker in the policy csv
+func policyMarker(csv string, marker string) string {
+	for _, line := range strings.Split(csv, "\n") {
+		if value, found := strings.CutPrefix(line, marker); found {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func sweeperTestAccount(name string, annotations map[string]string) *corev1.ServiceAccount {
+	labels := utils.CommonLabels()
+	labels[utils.TenantLabel] = "solar"
+	return &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "tenants", Labels: labels, Annotations: annotations}}
+}
+
+// Returns an account of the tenant lunar, which exists with the uid lunar-uid
+func sweeperTestLunarAccount(name string, uid string, cluster string) *corev1.ServiceAccount {
+	account := sweeperTestAccount(name, map[string]string{utils.TenantUIDAnnotation: uid})
+	account.Labels[utils.TenantLabel] = "lunar"
+	if cluster != "" {
+		account.Labels[utils.ClusterLabel] = cluster
+	}
+	return account
+}
+
+func sweeperTestAppProject(tenant string) *unstructured.Unstructured {
+	appProject := &unstructured.Unstructured{}
+	appProject.SetAPIVersion("argoproj.io/v1alpha1")
+	appProject.SetKind("AppProject")
+	appProject.SetName(tenant)
+	appProject.SetNamespace("argocd")
+	labels := utils.CommonLabels()
+	labels[utils.TenantLabel] = tenant
+	appProject.SetLabels(labels)
+	return appProject
+}
+
+func TestOrphanSweeper(t *testing.T) {
+	now := time.Now().UTC()
+	c := newFakeClient(t,
+		sweeperTestAccount("orphaned", nil),
+		sweeperTestAccount("retained", map[string]string{utils.RetainedAnnotation: now.Add(-48 * time.Hour).Format(time.RFC3339)}),
+		sweeperTestAccount("archived", map[string]string{utils.ArchivedAnnotation: now.Add(-time.Hour).Format(time.RFC3339)}),
+		sweeperTestAccount("expired", map[string]string{utils.ArchivedAnnotation: now.Add(-48 * time.Hour).Format(time.RFC3339)}),
+		&capsulev1beta2.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "lunar", UID: "lunar-uid"}},
+		sweeperTestLunarAccount("current", "lunar-uid", ""),
+		sweeperTestLunarAccount("recreated", "previous-uid", ""),
+		sweeperTestLunarAccount("unknown-cluster", "previous-uid", "removed"),
+		sweeperTestAppProject("spoke"),
+		sweeperTestAppProject("gone"),
+		&tenancyv1alpha1.TenantArgoBinding{ObjectMeta: metav1.ObjectMeta{
+			Name:   "spoke-removed-0a1b2c3d",
+			Labels: map[string]string{utils.TenantLabel: "spoke", utils.ClusterLabel: "removed"},
+		}},
+	)
+
+	recorder := record.NewFakeRecorder(10)
+	sweeper := &OrphanSweeper{
+		Tenancy: &TenancyController{
+			Client:   c,
+			Log:      logr.Discard(),
+			Recorder: recorder,
+			Options:  TenancyControllerOptions{ArgoCDNamespace: "argocd", ArchiveRetention: 24 * time.Hour},
+		},
+		Log:    logr.Discard(),
+		DryRun: true,
+	}
+	ctx := context.Background()
+
+	exists := func(name string) bool {
+		t.Helper()
+		err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: "tenants"}, &corev1.ServiceAccount{})
+		if client.IgnoreNotFound(err) != nil {
+			t.Fatal(err)
+		}
+		return !apierrors.IsNotFound(err)
+	}
+
+	// Expired archives are only reported in dry-run
+	if err := sweeper.expire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !exists("expired") {
+		t.Fatal("expired archive deleted in dry-run")
+	}
+	if len(recorder.Events) != 1 {
+		t.Fatalf("%d events recorded in dry-run, want 1", len(recorder.Events))
+	}
+
+	sweeper.DryRun = false
+	if err := sweeper.expire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"orphaned": true, "retained": true, "archived": true, "expired": false} {
+		if exists(name) != want {
+			t.Errorf("after expire: %s exists = %t, want %t", name, !want, want)
+		}
+	}
+
+	// The sweep leaves retained and archived artifacts alone
+	if err := sweeper.sweep(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// Artifacts of a previous tenant of the same name are orphans, those of unknown clusters are left alone
+	for name, want := range map[string]bool{"orphaned": false, "retained": true, "archived": true, "current": true, "recreated": false, "unknown-cluster": true} {
+		if exists(name) != want {
+			t.Errorf("after sweep: %s exists = %t, want %t", name, !want, want)
+		}
+	}
+
+	// The AppProject of a tenant of a cluster which is no longer configured is left alone
+	for name, want := range map[string]bool{"spoke": true, "gone": false} {
+		err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: "argocd"}, sweeperTestAppProject(name))
+		if client.IgnoreNotFound(err) != nil {
+			t.Fatal(err)
+		}
+		if !apierrors.IsNotFound(err) != want {
+			t.Errorf("after sweep: AppProject %s exists = %t, want %t", name, !want, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Returns the tlsClientConfig Argo CD uses to connect to capsule-proxy
+func (i *TenancyController) proxyTLSClientConfig(ctx context.Context) (map[string]interface{}, error) {
+	options := i.options(ctx)
+	if options.CapsuleProxyCA == nil {
+		return map[string]interface{}{
+			"insecure": true,
+		}, nil
+	}
+
+	ca, err := i.proxyCA(options.CapsuleProxyCA, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The per tenant proxy services are not part of the capsule-proxy certificate
+	serverName := options.CapsuleProxyServerName
+	if serverName == "" {
+		serverName = fmt.Sprintf("%s.%s.svc", options.CapsuleProxyServiceName, options.CapsuleProxyServiceNamespace)
+	}
+
+	return map[string]interface{}{
+		"caData":     base64.StdEncoding.EncodeToString(ca),
+		"serverName": serverName,
+	}, nil
+}
+
+// Reads the capsule-proxy CA certificate from the configured Secret or ConfigMap
+func (i *TenancyController) proxyCA(source *tenancyv1alpha1.CapsuleProxyCASpec, ctx context.Context) ([]byte, error) {
+	key := client.ObjectKey{Name: source.Name, Namespace: i.proxyCANamespace(source, ctx)}
+
+	var ca []byte
+	switch source.Kind {
+	case "ConfigMap":
+		configmap := &corev1.ConfigMap{}
+		if err := i.Client.Get(ctx, key, configmap); err != nil {
+			return nil, err
+		}
+		ca = []byte(configmap.Data[proxyCAKey(source)])
+	default:
+		secret := &corev1.Secret{}
+		if err := i.Client.Get(ctx, key, secret); err != nil {
+			return nil, err
+		}
+		ca = secret.Data[proxyCAKey(source)]
+	}
+
+	if len(ca) == 0 {
+		return nil, fmt.Errorf("capsule-proxy CA %s %s has no key %s", source.Kind, key, proxyCAKey(source))
+	}
+
+	return ca, nil
+}
+
+func (i *TenancyController) proxyCANamespace(source *tenancyv1alpha1.CapsuleProxyCASpec, ctx context.Context) string {
+	if source.Namespace != "" {
+		return source.Namespace
+	}
+	return i.options(ctx).CapsuleProxyServiceNamespace
+}
+
+func proxyCAKey(source *tenancyv1alpha1.CapsuleProxyCASpec) string {
+	if source.Key != "" {
+		return source.Key
+	}
+	return "ca.crt"
+}
+
+// Enqueues all tenants when the capsule-proxy CA changes
+func (i *TenancyController) enqueueOnProxyCA(ctx context.Context, object client.Object) []reconcile.Request {
+	source := i.options(ctx).CapsuleProxyCA
+	if source == nil || object.GetName() != source.Name || object.GetNamespace() != i.proxyCANamespace(source, ctx) {
+		return nil
+	}
+
+	kind := "Secret"
+	if _, ok := object.(*corev1.ConfigMap); ok {
+		kind = "ConfigMap"
+	}
+	if source.Kind != "" && source.Kind != kind {
+		return nil
+	}
+
+	return i.enqueueAllTenants(ctx, object)
+}
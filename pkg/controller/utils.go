@@ -2,20 +2,36 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"time"
 
+	tenancyv1alpha1 "git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/api/v1alpha1"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/pkg/metrics"
 	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-func (i *TenancyController) getProxyServiceName(tenant *capsulev1beta2.Tenant) (service string, url string) {
+func (i *TenancyController) getProxyServiceName(tenant *capsulev1beta2.Tenant, ctx context.Context) (service string, url string) {
 	serviceName := tenant.Name + "-proxy"
 
-	return serviceName, fmt.Sprintf("https://%s.%s.svc:9001", serviceName, i.Options.CapsuleProxyServiceNamespace)
+	return serviceName, fmt.Sprintf("https://%s.%s.svc:9001", serviceName, i.options(ctx).CapsuleProxyServiceNamespace)
 }
 
-func (i *TenancyController) addServiceAccountOwner(namespace string, name string, tenant *capsulev1beta2.Tenant, ctx context.Context) (err error) {
+// Returns the namespace of the tenant's ServiceAccount
+func (i *TenancyController) serviceAccountNamespace(tenant *capsulev1beta2.Tenant, ctx context.Context) string {
+	if utils.IsSystemTenant(tenant) {
+		return i.options(ctx).SystemTenantNamespace
+	}
+	return i.options(ctx).UserTenantNamespace
+}
+
+func (i *TenancyController) addServiceAccountOwner(namespace string, name string, tenant *capsulev1beta2.Tenant, cluster *tenantCluster, ctx context.Context) (err error) {
 	owner := capsulev1beta2.OwnerSpec{
 		Kind: "ServiceAccount",
 		Name: "system:serviceaccount:" + namespace + ":" + name,
@@ -29,10 +45,10 @@ func (i *TenancyController) addServiceAccountOwner(namespace string, name string
 	}
 
 	err = retry.RetryOnConflict(retry.DefaultBackoff, func() (conflict error) {
-		_ = i.Client.Get(ctx, types.NamespacedName{Name: tenant.Name}, tenant)
+		_ = cluster.client.Get(ctx, types.NamespacedName{Name: tenant.Name}, tenant)
 
 		tenant.Spec.Owners = append(tenant.Spec.Owners, owner)
-		if conflict = i.Client.Update(ctx, tenant); err != nil {
+		if conflict = cluster.client.Update(ctx, tenant); err != nil {
 			return err
 		}
 		return
@@ -40,3 +56,118 @@ func (i *TenancyController) addServiceAccountOwner(namespace string, name string
 
 	return
 }
+
+// Enqueues all tenants of all clusters, used when a resource affecting all tenants changes
+func (i *TenancyController) enqueueAllTenants(ctx context.Context, _ client.Object) []reconcile.Request {
+	requests := []reconcile.Request{}
+	for _, cluster := range i.tenantClusters() {
+		tenants := &capsulev1beta2.TenantList{}
+		if err := cluster.client.List(ctx, tenants); err != nil {
+			i.Log.Error(err, "unable to list tenants", "cluster", cluster.name())
+			continue
+		}
+
+		for _, tenant := range tenants.Items {
+			requests = append(requests, cluster.request(tenant.Name))
+		}
+	}
+
+	return requests
+}
+
+// Returns the size of the configmap data in bytes
+func configMapSize(configmap *corev1.ConfigMap) (size int) {
+	for key, value := range configmap.Data {
+		size += len(key) + len(value)
+	}
+	return
+}
+
+// Interval in which the managed tenants are counted
+const tenantMetricsInterval = time.Minute
+
+// Updates the tenant metrics every tenantMetricsInterval until the context is done
+func (i *TenancyController) countTenants(ctx context.Context) error {
+	ticker := time.NewTicker(tenantMetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := i.updateTenantMetrics(ctx); err != nil {
+			i.Log.V(1).Error(err, "Unable to update tenant metrics")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Counts the tenants managed by the controller in all clusters by their type
+func (i *TenancyController) updateTenantMetrics(ctx context.Context) error {
+	system, user := 0, 0
+	for _, cluster := range i.tenantClusters() {
+		tenants := &capsulev1beta2.TenantList{}
+		if err := cluster.client.List(ctx, tenants); err != nil {
+			return err
+		}
+
+		for _, tenant := range tenants.Items {
+			if utils.IsSystemTenant(&tenant) {
+				system++
+			} else {
+				user++
+			}
+		}
+	}
+
+	metrics.ManagedTenants.WithLabelValues("system").Set(float64(system))
+	metrics.ManagedTenants.WithLabelValues("user").Set(float64(user))
+
+	return nil
+}
+
+// Returns the bearer token of the tenant's Argo cluster secret in any instance, empty if there is none
+func (i *TenancyController) clusterSecretToken(tenant *capsulev1beta2.Tenant, cluster *tenantCluster, ctx context.Context) string {
+	for _, instance := range i.argoInstances(ctx) {
+		secret := &corev1.Secret{}
+		if err := i.Client.Get(ctx, types.NamespacedName{Name: cluster.argoName(tenant.Name), Namespace: instance.Namespace}, secret); err != nil {
+			continue
+		}
+
+		config := struct {
+			BearerToken string `json:"bearerToken"`
+		}{}
+		if err := json.Unmarshal(secret.Data["config"], &config); err != nil || config.BearerToken == "" {
+			continue
+		}
+
+		return config.BearerToken
+	}
+
+	return ""
+}
+
+// Returns when the tenant has to be reconciled again to rotate its tokens
+func (i *TenancyController) tokenRotationAfter(status *tenancyv1alpha1.TenantArgoBindingStatus, ctx context.Context) time.Duration {
+	var rotation time.Duration
+	if status.TokenExpirationTimestamp != nil {
+		rotation = time.Until(status.TokenExpirationTimestamp.Add(-i.options(ctx).TokenTTL / 3))
+	}
+	if status.CITokenExpirationTimestamp != nil {
+		ciRotation := time.Until(status.CITokenExpirationTimestamp.Add(-i.options(ctx).CITokenTTL / 3))
+		if status.TokenExpirationTimestamp == nil || ciRotation < rotation {
+			rotation = ciRotation
+		}
+	}
+	if status.TokenExpirationTimestamp == nil && status.CITokenExpirationTimestamp == nil {
+		return 0
+	}
+
+	if rotation < time.Minute {
+		return time.Minute
+	}
+
+	return rotation
+}
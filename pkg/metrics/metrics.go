@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "tenancy_controller"
+
+// Provisioning steps used as label values
+const (
+	StepServiceAccount = "serviceaccount"
+	StepProxyService   = "proxy-service"
+	StepClusterSecret  = "cluster-secret"
+	StepAppProject     = "appproject"
+	StepRBACConfigMap  = "rbac-cm"
+	StepAppsNamespace  = "apps-namespace"
+	StepCIToken        = "ci-token"
+)
+
+var (
+	StepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "step_duration_seconds",
+		Help:      "Duration of the tenant provisioning steps",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"step"})
+
+	StepErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "step_errors_total",
+		Help:      "Number of failed tenant provisioning steps",
+	}, []string{"step"})
+
+	ManagedTenants = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "managed_tenants",
+		Help:      "Number of tenants managed by the controller",
+	}, []string{"type"})
+
+	RBACConfigMapSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rbac_configmap_size_bytes",
+		Help:      "Size of the data in the RBAC ConfigMap of the Argo CD instance",
+	}, []string{"instance"})
+
+	TokenRotations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_rotations_total",
+		Help:      "Number of ServiceAccount tokens requested for Argo CD",
+	})
+
+	DriftCorrections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "drift_corrections_total",
+		Help:      "Number of provisioned objects which were changed outside of the controller and reverted",
+	}, []string{"step"})
+
+	ShadowChanges = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "shadow_changes",
+		Help:      "Number of objects the last shadow reconciliation of the tenant would create, update or delete",
+	}, []string{"tenant", "operation"})
+
+	TokenExpiration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "token_expiration_timestamp_seconds",
+		Help:      "Expiration of the ServiceAccount token used by Argo CD",
+	}, []string{"tenant"})
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(
+		StepDuration,
+		StepErrors,
+		ManagedTenants,
+		RBACConfigMapSize,
+		TokenRotations,
+		TokenExpiration,
+		DriftCorrections,
+		ShadowChanges,
+	)
+}
+
+// Observes the duration of a step started at start and counts it as error if err is set
+func ObserveStep(step string, start time.Time, err error) {
+	StepDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+	if err != nil {
+		StepErrors.WithLabelValues(step).Inc()
+	}
+}
@@ -0,0 +1,329 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Lifetime of the generated certificates, they are renewed once less than a third is left
+const certificateValidity = 365 * 24 * time.Hour
+
+// Interval in which the certificate is checked for renewal
+const certificateCheckInterval = 24 * time.Hour
+
+// Duration for which a replaced CA stays in the CA bundle, every replica reloads the renewed certificate within
+const caRetention = 2 * certificateCheckInterval
+
+var _ reconcile.Reconciler = &CertificateController{}
+
+// CertificateController issues a self-signed serving certificate for the webhook service, stores it in a Secret
+// shared by all replicas, writes it to the certificate directory of the webhook server and injects the CA
+// into the ValidatingWebhookConfiguration.
+type CertificateController struct {
+	// Client reading and writing without cache, the certificate is needed before the manager starts
+	Client        client.Client
+	Log           logr.Logger
+	Namespace     string
+	SecretName    string
+	ServiceName   string
+	Configuration string
+	CertDir       string
+}
+
+func (c *CertificateController) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.Add(c); err != nil {
+		return err
+	}
+
+	// The CA is injected again when the configuration is replaced, e.g. by a chart upgrade
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("webhook-certificate").
+		For(&admissionregistrationv1.ValidatingWebhookConfiguration{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			return object.GetName() == c.Configuration
+		}))).
+		Complete(c)
+}
+
+func (c *CertificateController) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result, error) {
+	return ctrl.Result{}, c.Ensure(ctx)
+}
+
+// Every replica renews the certificate, the webhook server reloads the files
+func (c *CertificateController) NeedLeaderElection() bool {
+	return false
+}
+
+func (c *CertificateController) Start(ctx context.Context) error {
+	ticker := time.NewTicker(certificateCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := c.Ensure(ctx); err != nil {
+				c.Log.Error(err, "Unable to renew webhook certificate")
+			}
+		}
+	}
+}
+
+// Ensures a valid certificate in the Secret and the certificate directory and the CA in the configuration
+func (c *CertificateController) Ensure(ctx context.Context) error {
+	secret, err := c.secret(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := c.writeFiles(secret); err != nil {
+		return err
+	}
+
+	return c.injectCA(secret.Data["ca.crt"], ctx)
+}
+
+// Returns the Secret holding a valid certificate, issuing a new one if necessary
+func (c *CertificateController) secret(ctx context.Context) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	err := c.Client.Get(ctx, client.ObjectKey{Name: c.SecretName, Namespace: c.Namespace}, secret)
+	if client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	found := err == nil
+	if found && c.valid(secret) {
+		// Replaced CAs are dropped once every replica had the chance to reload the certificate
+		certificate, _ := servingCertificate(secret)
+		bundle := retainedCAs(secret.Data["ca.crt"], certificate, time.Now())
+		if bytes.Equal(bundle, secret.Data["ca.crt"]) {
+			return secret, nil
+		}
+		secret.Data["ca.crt"] = bundle
+		return c.update(secret, ctx)
+	}
+
+	data, err := c.issue()
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: c.SecretName, Namespace: c.Namespace},
+			Type:       corev1.SecretTypeTLS,
+			Data:       data,
+		}
+		if err := c.Client.Create(ctx, secret); err != nil {
+			// Another replica was faster
+			if apierrors.IsAlreadyExists(err) {
+				return secret, c.Client.Get(ctx, client.ObjectKeyFromObject(secret), secret)
+			}
+			return nil, err
+		}
+	} else {
+		// Replicas which did not yet reload the certificate still serve the one signed by the previous CA
+		certificate, err := servingCertificate(&corev1.Secret{Data: data})
+		if err != nil {
+			return nil, err
+		}
+		data["ca.crt"] = append(data["ca.crt"], retainedCAs(secret.Data["ca.crt"], certificate, time.Now())...)
+
+		secret.Data = data
+		if _, err := c.update(secret, ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	c.Log.Info("Webhook certificate issued", "secret", c.Namespace+"/"+c.SecretName)
+
+	return secret, nil
+}
+
+// Updates the Secret, returning the one of another replica which updated it first
+func (c *CertificateController) update(secret *corev1.Secret, ctx context.Context) (*corev1.Secret, error) {
+	if err := c.Client.Update(ctx, secret); err != nil {
+		if apierrors.IsConflict(err) {
+			return secret, c.Client.Get(ctx, client.ObjectKeyFromObject(secret), secret)
+		}
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// Returns whether the certificate of the Secret matches the service and is not due for renewal
+func (c *CertificateController) valid(secret *corev1.Secret) bool {
+	if len(secret.Data["ca.crt"]) == 0 {
+		return false
+	}
+
+	certificate, err := servingCertificate(secret)
+	if err != nil {
+		return false
+	}
+
+	if time.Until(certificate.NotAfter) < certificateValidity/3 {
+		return false
+	}
+
+	return certificate.VerifyHostname(c.hostname()) == nil
+}
+
+func servingCertificate(secret *corev1.Secret) (*x509.Certificate, error) {
+	pair, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(pair.Certificate[0])
+}
+
+// Returns the CAs of the bundle which are not expired and either signed the serving certificate or were replaced
+// less than caRetention ago. Replicas reload the certificate once per check interval, until then the API server
+// must trust the previous CA as well.
+func retainedCAs(bundle []byte, certificate *x509.Certificate, now time.Time) []byte {
+	retained := []byte{}
+	for rest := bundle; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		ca, err := x509.ParseCertificate(block.Bytes)
+		if err != nil || now.After(ca.NotAfter) {
+			continue
+		}
+		if certificate.CheckSignatureFrom(ca) != nil && now.Sub(certificate.NotBefore) > caRetention {
+			continue
+		}
+
+		retained = append(retained, pem.EncodeToMemory(block)...)
+	}
+
+	return retained
+}
+
+func (c *CertificateController) hostname() string {
+	return fmt.Sprintf("%s.%s.svc", c.ServiceName, c.Namespace)
+}
+
+// Issues a CA and a serving certificate for the webhook service signed by it
+func (c *CertificateController) issue() (map[string][]byte, error) {
+	now := time.Now()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(now.UnixNano()),
+		Subject:               pkix.Name{CommonName: "tenancy-controller-webhook-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certificateValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano() + 1),
+		Subject:      pkix.Name{CommonName: c.hostname()},
+		DNSNames:     []string{c.ServiceName, c.ServiceName + "." + c.Namespace, c.hostname(), c.hostname() + ".cluster.local"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certificateValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string][]byte{
+		"ca.crt":                pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		corev1.TLSCertKey:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		corev1.TLSPrivateKeyKey: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+// Writes the certificate for the webhook server, unchanged files are not touched
+func (c *CertificateController) writeFiles(secret *corev1.Secret) error {
+	if err := os.MkdirAll(c.CertDir, 0o700); err != nil {
+		return err
+	}
+
+	for _, key := range []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey} {
+		path := filepath.Join(c.CertDir, key)
+		if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, secret.Data[key]) {
+			continue
+		}
+		if err := os.WriteFile(path, secret.Data[key], 0o600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Sets the CA of all webhooks of the configuration
+func (c *CertificateController) injectCA(ca []byte, ctx context.Context) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		configuration := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+		if err := c.Client.Get(ctx, client.ObjectKey{Name: c.Configuration}, configuration); err != nil {
+			return err
+		}
+
+		changed := false
+		for idx := range configuration.Webhooks {
+			if !bytes.Equal(configuration.Webhooks[idx].ClientConfig.CABundle, ca) {
+				configuration.Webhooks[idx].ClientConfig.CABundle = ca
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+
+		c.Log.V(3).Info("Injecting webhook CA", "configuration", c.Configuration)
+
+		return c.Client.Update(ctx, configuration)
+	})
+}
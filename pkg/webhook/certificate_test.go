@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRetainedCAs(t *testing.T) {
+	controller := &CertificateController{Namespace: "tenancy", ServiceName: "tenancy-controller-webhook"}
+
+	previous, err := controller.issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewed, err := controller.issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, err := servingCertificate(&corev1.Secret{Data: renewed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := append(append([]byte{}, renewed["ca.crt"]...), previous["ca.crt"]...)
+
+	// Replicas which did not reload the renewed certificate are still trusted
+	if got := retainedCAs(bundle, certificate, time.Now()); !bytes.Equal(got, bundle) {
+		t.Fatal("previous CA dropped right after the renewal")
+	}
+
+	// Once every replica reloaded the certificate only its CA is left
+	if got := retainedCAs(bundle, certificate, time.Now().Add(caRetention)); !bytes.Equal(got, renewed["ca.crt"]) {
+		t.Fatal("previous CA kept after the retention")
+	}
+}
@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/roles"
+	"git.bedag.cloud/gelan/gelan-infra/controllers/tenancy-controller/internal/utils"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Tenant names which collide with objects of Argo CD, "default" is the default AppProject
+var DefaultReservedTenantNames = []string{"default"}
+
+// Characters which end a field or line of the Argo CD policy csv
+const policyDelimiters = ",\"\n\r"
+
+var _ admission.CustomValidator = &TenantValidator{}
+
+// TenantValidator rejects Tenants whose names would corrupt the Argo CD RBAC policies or AppProjects
+type TenantValidator struct {
+	ReservedNames []string
+}
+
+func (v *TenantValidator) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&capsulev1beta2.Tenant{}).
+		WithValidator(v).
+		Complete()
+}
+
+func (v *TenantValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(obj, nil)
+}
+
+// Only subjects added by the update are validated, Tenants created before the webhook must stay updatable
+func (v *TenantValidator) ValidateUpdate(_ context.Context, oldObj runtime.Object, obj runtime.Object) (admission.Warnings, error) {
+	old, ok := oldObj.(*capsulev1beta2.Tenant)
+	if !ok {
+		return nil, fmt.Errorf("expected a Tenant, got %T", oldObj)
+	}
+
+	// Removing the finalizers of a deleted tenant must not be blocked
+	if old.DeletionTimestamp != nil {
+		return nil, nil
+	}
+
+	return nil, v.validate(obj, old)
+}
+
+// Deleting tenants removes their policies
+func (v *TenantValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// Validates the tenant, subjects of the old tenant are accepted as they are
+func (v *TenantValidator) validate(obj runtime.Object, old *capsulev1beta2.Tenant) error {
+	tenant, ok := obj.(*capsulev1beta2.Tenant)
+	if !ok {
+		return fmt.Errorf("expected a Tenant, got %T", obj)
+	}
+
+	existing := map[string]bool{}
+	if old != nil {
+		for _, owner := range old.Spec.Owners {
+			existing[string(owner.Kind)+"/"+owner.Name] = true
+		}
+		for _, binding := range old.Spec.AdditionalRoleBindings {
+			for _, subject := range binding.Subjects {
+				existing[subject.Kind+"/"+subject.Name] = true
+			}
+		}
+	}
+
+	errs := field.ErrorList{}
+
+	// The name of a tenant is immutable
+	if old == nil && utils.StringSliceContains(v.ReservedNames, tenant.Name) {
+		errs = append(errs, field.Forbidden(field.NewPath("metadata", "name"), fmt.Sprintf("%q is reserved by Argo CD", tenant.Name)))
+	}
+
+	for idx, owner := range tenant.Spec.Owners {
+		if owner.Kind != "User" && owner.Kind != "Group" || existing[string(owner.Kind)+"/"+owner.Name] {
+			continue
+		}
+		errs = append(errs, validateSubjectName(field.NewPath("spec", "owners").Index(idx).Child("name"), owner.Name)...)
+	}
+
+	for idx, binding := range tenant.Spec.AdditionalRoleBindings {
+		for subjectIdx, subject := range binding.Subjects {
+			if subject.Kind != "User" && subject.Kind != "Group" || existing[subject.Kind+"/"+subject.Name] {
+				continue
+			}
+			errs = append(errs, validateSubjectName(field.NewPath("spec", "additionalRoleBindings").Index(idx).Child("subjects").Index(subjectIdx).Child("name"), subject.Name)...)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(capsulev1beta2.GroupVersion.WithKind("Tenant").GroupKind(), tenant.Name, errs)
+}
+
+// Users and groups are written into the Argo CD policy csv, which has no escaping
+func validateSubjectName(path *field.Path, name string) field.ErrorList {
+	if strings.TrimSpace(name) == "" {
+		return field.ErrorList{field.Required(path, "users and groups are assigned to Argo CD roles by name")}
+	}
+
+	if strings.ContainsAny(name, policyDelimiters) {
+		return field.ErrorList{field.Invalid(path, name, "must not contain commas, double quotes or line breaks, which would corrupt the Argo CD RBAC policy")}
+	}
+
+	if strings.TrimSpace(name) != name {
+		return field.ErrorList{field.Invalid(path, name, "must not start or end with whitespace, which Argo CD strips from the RBAC policy")}
+	}
+
+	// Casbin would treat the subject as role, granting it the permissions of e.g. another tenant
+	if strings.HasPrefix(name, roles.RolePrefix) || strings.HasPrefix(name, roles.ProjectPrefix) {
+		return field.ErrorList{field.Invalid(path, name, fmt.Sprintf("must not start with %s or %s, which Argo CD reserves for roles", roles.RolePrefix, roles.ProjectPrefix))}
+	}
+
+	// Anything else the policy csv can not hold
+	if err := roles.ValidateSubject(name); err != nil {
+		return field.ErrorList{field.Invalid(path, name, err.Error())}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testTenant(owners ...string) *capsulev1beta2.Tenant {
+	tenant := &capsulev1beta2.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "solar"}}
+	for _, owner := range owners {
+		tenant.Spec.Owners = append(tenant.Spec.Owners, capsulev1beta2.OwnerSpec{Kind: "User", Name: owner})
+	}
+	return tenant
+}
+
+func TestTenantValidator(t *testing.T) {
+	validator := &TenantValidator{ReservedNames: DefaultReservedTenantNames}
+	ctx := context.Background()
+
+	for _, name := range []string{"role:admin", "proj:lunar:owners", "alice,bob", " alice"} {
+		if _, err := validator.ValidateCreate(ctx, testTenant(name)); err == nil {
+			t.Errorf("ValidateCreate() accepted owner %q", name)
+		}
+	}
+
+	if _, err := validator.ValidateCreate(ctx, testTenant("alice")); err != nil {
+		t.Errorf("ValidateCreate() rejected a valid tenant: %v", err)
+	}
+
+	// Owners of tenants created before the webhook are kept
+	old := testTenant("role:admin")
+	if _, err := validator.ValidateUpdate(ctx, old, testTenant("role:admin", "alice")); err != nil {
+		t.Errorf("ValidateUpdate() rejected an existing owner: %v", err)
+	}
+	if _, err := validator.ValidateUpdate(ctx, old, testTenant("role:admin", "proj:lunar:owners")); err == nil {
+		t.Error("ValidateUpdate() accepted an added owner with a role prefix")
+	}
+
+	// Removing the finalizers of a deleted tenant
+	deleted := testTenant("proj:lunar:owners")
+	deleted.DeletionTimestamp = &metav1.Time{}
+	deleted.Finalizers = []string{"tenancy.gelan.cloud/finalizer"}
+	updated := deleted.DeepCopy()
+	updated.Finalizers = nil
+	if _, err := validator.ValidateUpdate(ctx, deleted, updated); err != nil {
+		t.Errorf("ValidateUpdate() blocked the finalizer removal: %v", err)
+	}
+}